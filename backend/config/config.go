@@ -2,6 +2,8 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"time"
 )
 
 type Config struct {
@@ -10,9 +12,23 @@ type Config struct {
 	DBUser        string
 	DBPassword    string
 	DBName        string
+	AdminUsername string
 	AdminPassword string
 	ResetPassword string
 	ServerPort    string
+	SessionTTL    time.Duration
+	ConfirmTTL    time.Duration
+
+	// Idempotency-Key 的保存时间
+	IdempotencyTTL time.Duration
+
+	// 是否运行自动积分规则（多实例部署时只在一个实例上开启）
+	SchedulerEnabled bool
+
+	// 登录防爆破
+	LockoutMaxAttempts int
+	LockoutBase        time.Duration
+	LockoutMax         time.Duration
 }
 
 func Load() *Config {
@@ -22,9 +38,20 @@ func Load() *Config {
 		DBUser:        getEnv("DB_USER", "root"),
 		DBPassword:    getEnv("DB_PASSWORD", ""),
 		DBName:        getEnv("DB_NAME", "score_db"),
+		AdminUsername: getEnv("ADMIN_USERNAME", "admin"),
 		AdminPassword: getEnv("ADMIN_PASSWORD", "admin123"),
 		ResetPassword: getEnv("RESET_PASSWORD", "reset123"),
 		ServerPort:    getEnv("SERVER_PORT", "8080"),
+		SessionTTL:    time.Duration(getEnvInt("SESSION_TTL_HOURS", 12)) * time.Hour,
+		ConfirmTTL:    time.Duration(getEnvInt("CONFIRM_TTL_SECONDS", 120)) * time.Second,
+
+		IdempotencyTTL: time.Duration(getEnvInt("IDEMPOTENCY_TTL_HOURS", 24)) * time.Hour,
+
+		SchedulerEnabled: getEnv("SCHEDULER_ENABLED", "true") == "true",
+
+		LockoutMaxAttempts: getEnvInt("LOCKOUT_MAX_ATTEMPTS", 5),
+		LockoutBase:        time.Duration(getEnvInt("LOCKOUT_BASE_SECONDS", 30)) * time.Second,
+		LockoutMax:         time.Duration(getEnvInt("LOCKOUT_MAX_SECONDS", 3600)) * time.Second,
 	}
 }
 
@@ -34,3 +61,12 @@ func getEnv(key, defaultValue string) string {
 	}
 	return defaultValue
 }
+
+func getEnvInt(key string, defaultValue int) int {
+	if value := os.Getenv(key); value != "" {
+		if n, err := strconv.Atoi(value); err == nil {
+			return n
+		}
+	}
+	return defaultValue
+}
@@ -1,8 +1,10 @@
 package database
 
 import (
+	"encoding/json"
 	"fmt"
 	"log"
+	"time"
 
 	"score-backend/config"
 	"score-backend/models"
@@ -28,49 +30,169 @@ func Init(cfg *config.Config) {
 		log.Fatal("Failed to connect to database:", err)
 	}
 
+	// 升级前只有一个积分，迁移后积分币从当前积分开始
+	initCoins := DB.Migrator().HasTable(&models.Student{}) && !DB.Migrator().HasColumn(&models.Student{}, "coins")
+
 	// 自动迁移
 	err = DB.AutoMigrate(
+		&models.Class{},
 		&models.Student{},
+		&models.Group{},
+		&models.GroupScoreRecord{},
 		&models.ScoreRecord{},
+		&models.ScoreOperation{},
+		&models.Term{},
+		&models.TermStanding{},
+		&models.TermGroupStanding{},
 		&models.ScoreTemplate{},
+		&models.CategoryLimit{},
+		&models.Reward{},
+		&models.Redemption{},
+		&models.ScoreRule{},
+		&models.ScoreRuleRun{},
+		&models.Streak{},
+		&models.StreakBonus{},
 		&models.Rank{},
 		&models.Setting{},
+		&models.Teacher{},
+		&models.Session{},
+		&models.AuditEntry{},
+		&models.ConfirmToken{},
+		&models.IdempotencyKey{},
+		&models.Parent{},
+		&models.ParentInvite{},
+		&models.APIKey{},
 	)
 	if err != nil {
 		log.Fatal("Failed to migrate database:", err)
 	}
 
-	// 初始化默认段位
-	initDefaultRanks()
+	if initCoins {
+		DB.Exec("UPDATE students SET coins = score WHERE score > 0")
+	}
+
+	// 学号改为班级内唯一，删除旧的全局唯一索引
+	if DB.Migrator().HasIndex(&models.Student{}, "idx_students_student_no") {
+		DB.Migrator().DropIndex(&models.Student{}, "idx_students_student_no")
+	}
+
+	// 初始化默认管理员账号
+	initDefaultTeacher(cfg)
 
-	// 初始化默认积分模板
-	initDefaultTemplates()
+	// 初始化默认班级，并把升级前的数据归入该班级
+	initDefaultClass()
+
+	// 初始化各班级的当前学期、默认段位和积分模板
+	var classes []models.Class
+	DB.Order("id ASC").Find(&classes)
+	for _, class := range classes {
+		SeedClassDefaults(class.ID)
+	}
+
+	// 升级前的全局积分上下限和隐私策略复制到每个班级
+	splitClassSetting("score_policy", classes)
+	splitPrivacySetting(classes)
 
 	log.Println("Database connected and migrated successfully")
 }
 
-func initDefaultRanks() {
-	// 清空并重新创建固定段位配置
-	DB.Exec("DELETE FROM ranks")
-
-	ranks := []models.Rank{
-		{Name: "学徒", MinScore: 0, Color: "#9CA3AF", Icon: "🌱", SortOrder: 1},
-		{Name: "青铜", MinScore: 20, Color: "#CD7F32", Icon: "🥉", SortOrder: 2},
-		{Name: "白银", MinScore: 50, Color: "#A8A9AD", Icon: "🥈", SortOrder: 3},
-		{Name: "黄金", MinScore: 100, Color: "#FFD700", Icon: "🏅", SortOrder: 4},
-		{Name: "铂金", MinScore: 180, Color: "#00CED1", Icon: "💠", SortOrder: 5},
-		{Name: "钻石", MinScore: 280, Color: "#B9F2FF", Icon: "💎", SortOrder: 6},
-		{Name: "大师", MinScore: 400, Color: "#9400D3", Icon: "🔮", SortOrder: 7},
-		{Name: "宗师", MinScore: 550, Color: "#FF6B6B", Icon: "⭐", SortOrder: 8},
-		{Name: "王者", MinScore: 750, Color: "#FF4500", Icon: "👑", SortOrder: 9},
-		{Name: "传奇", MinScore: 1000, Color: "#FFD700", Icon: "🏆", SortOrder: 10},
-	}
-	DB.Create(&ranks)
+func initDefaultClass() {
+	var class models.Class
+	if err := DB.Order("id ASC").First(&class).Error; err != nil {
+		class = models.Class{Name: "默认班级"}
+		DB.Create(&class)
+	}
+
+	DB.Model(&models.Student{}).Where("class_id = 0").Update("class_id", class.ID)
+	DB.Model(&models.ScoreTemplate{}).Where("class_id = 0").Update("class_id", class.ID)
+	// 旧版本的全局段位每次启动都会重建，直接删除，由默认段位替代
+	DB.Where("class_id = 0").Delete(&models.Rank{})
+
+	// 没有分配班级的非管理员教师归入默认班级
+	var teachers []models.Teacher
+	DB.Where("role <> ?", models.RoleOwner).
+		Where("id NOT IN (?)", DB.Table("teacher_classes").Select("teacher_id")).
+		Find(&teachers)
+	for i := range teachers {
+		DB.Model(&teachers[i]).Association("Classes").Append(&class)
+	}
+}
+
+// 把升级前的全局配置项复制为每个班级的 <key>:<班级 ID>，然后删除全局配置
+func splitClassSetting(key string, classes []models.Class) {
+	var global models.Setting
+	if err := DB.Where("`key` = ?", key).First(&global).Error; err != nil {
+		return
+	}
+	for _, class := range classes {
+		setting := models.Setting{Key: fmt.Sprintf("%s:%d", key, class.ID), Value: global.Value}
+		DB.Where("`key` = ?", setting.Key).FirstOrCreate(&setting)
+	}
+	DB.Delete(&global)
+}
+
+// 升级前的全局隐私策略复制到每个班级；展示令牌只保留给默认班级（升级前唯一的班级），
+// 其他班级要求令牌时需要重新生成，在此之前公开数据无法访问
+func splitPrivacySetting(classes []models.Class) {
+	var global models.Setting
+	if err := DB.Where("`key` = ?", "privacy_policy").First(&global).Error; err != nil {
+		return
+	}
+	var policy map[string]interface{}
+	if err := json.Unmarshal([]byte(global.Value), &policy); err != nil {
+		return
+	}
+	for i, class := range classes {
+		if i > 0 {
+			delete(policy, "display_token")
+		}
+		data, _ := json.Marshal(policy)
+		setting := models.Setting{Key: fmt.Sprintf("privacy_policy:%d", class.ID), Value: string(data)}
+		DB.Where("`key` = ?", setting.Key).FirstOrCreate(&setting)
+	}
+	DB.Delete(&global)
 }
 
-func initDefaultTemplates() {
+// 班级没有学期、段位或积分模板时创建默认配置
+func SeedClassDefaults(classID uint) {
 	var count int64
-	DB.Model(&models.ScoreTemplate{}).Count(&count)
+	DB.Model(&models.Term{}).Where("class_id = ? AND closed_at IS NULL", classID).Count(&count)
+	if count == 0 {
+		term := models.Term{ClassID: classID, Name: "第一学期", StartedAt: time.Now()}
+		DB.Create(&term)
+	}
+	// 升级前的积分记录归入当前学期
+	var term models.Term
+	if DB.Where("class_id = ? AND closed_at IS NULL", classID).First(&term).Error == nil {
+		DB.Model(&models.ScoreRecord{}).
+			Where("term_id = 0 AND student_id IN (?)", DB.Model(&models.Student{}).Select("id").Where("class_id = ?", classID)).
+			Update("term_id", term.ID)
+		DB.Model(&models.GroupScoreRecord{}).
+			Where("term_id = 0 AND group_id IN (?)", DB.Model(&models.Group{}).Select("id").Where("class_id = ?", classID)).
+			Update("term_id", term.ID)
+	}
+
+	DB.Model(&models.Rank{}).Where("class_id = ?", classID).Count(&count)
+	if count == 0 {
+		ranks := []models.Rank{
+			{Name: "学徒", MinScore: 0, Color: "#9CA3AF", Icon: "🌱", SortOrder: 1},
+			{Name: "青铜", MinScore: 20, Color: "#CD7F32", Icon: "🥉", SortOrder: 2},
+			{Name: "白银", MinScore: 50, Color: "#A8A9AD", Icon: "🥈", SortOrder: 3},
+			{Name: "黄金", MinScore: 100, Color: "#FFD700", Icon: "🏅", SortOrder: 4},
+			{Name: "铂金", MinScore: 180, Color: "#00CED1", Icon: "💠", SortOrder: 5},
+			{Name: "钻石", MinScore: 280, Color: "#B9F2FF", Icon: "💎", SortOrder: 6},
+			{Name: "大师", MinScore: 400, Color: "#9400D3", Icon: "🔮", SortOrder: 7},
+			{Name: "宗师", MinScore: 550, Color: "#FF6B6B", Icon: "⭐", SortOrder: 8},
+			{Name: "王者", MinScore: 750, Color: "#FF4500", Icon: "👑", SortOrder: 9},
+			{Name: "传奇", MinScore: 1000, Color: "#FFD700", Icon: "🏆", SortOrder: 10},
+		}
+		for i := range ranks {
+			ranks[i].ClassID = classID
+		}
+		DB.Create(&ranks)
+	}
+
+	DB.Model(&models.ScoreTemplate{}).Where("class_id = ?", classID).Count(&count)
 	if count == 0 {
 		templates := []models.ScoreTemplate{
 			{Name: "回答问题", Value: 2, Category: "课堂表现"},
@@ -81,6 +203,21 @@ func initDefaultTemplates() {
 			{Name: "未交作业", Value: -2, Category: "作业"},
 			{Name: "课堂违纪", Value: -2, Category: "纪律"},
 		}
+		for i := range templates {
+			templates[i].ClassID = classID
+		}
 		DB.Create(&templates)
 	}
 }
+
+func initDefaultTeacher(cfg *config.Config) {
+	var count int64
+	DB.Model(&models.Teacher{}).Count(&count)
+	if count == 0 {
+		teacher := models.Teacher{Username: cfg.AdminUsername, Name: "管理员", Role: models.RoleOwner}
+		if err := teacher.SetPassword(cfg.AdminPassword); err != nil {
+			log.Fatal("Failed to hash admin password:", err)
+		}
+		DB.Create(&teacher)
+	}
+}
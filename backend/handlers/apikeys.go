@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============ API 密钥 ============
+
+func GetAPIKeys(c *gin.Context) {
+	var keys []models.APIKey
+	database.DB.Order("id DESC").Find(&keys)
+	c.JSON(http.StatusOK, gin.H{"data": keys, "scopes": middleware.APIKeyScopes})
+}
+
+// 创建 API 密钥，明文密钥只在本次响应中返回
+func CreateAPIKey(c *gin.Context) {
+	var input struct {
+		Name          string   `json:"name" binding:"required"`
+		Scopes        []string `json:"scopes" binding:"required"`
+		ExpiresInDays int      `json:"expires_in_days"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !validAPIKeyScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的权限范围: " + scope})
+			return
+		}
+	}
+
+	plain, prefix, hash, err := middleware.NewAPIKey()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	key := models.APIKey{
+		Name:      input.Name,
+		Prefix:    prefix,
+		KeyHash:   hash,
+		Scopes:    strings.Join(input.Scopes, ","),
+		CreatedBy: middleware.CurrentTeacher(c).ID,
+	}
+	if input.ExpiresInDays > 0 {
+		expiresAt := time.Now().AddDate(0, 0, input.ExpiresInDays)
+		key.ExpiresAt = &expiresAt
+	}
+	if err := database.DB.Create(&key).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	middleware.AuditAfter(c, key)
+
+	c.JSON(http.StatusCreated, gin.H{"data": key, "key": plain})
+}
+
+// 吊销 API 密钥
+func RevokeAPIKey(c *gin.Context) {
+	var key models.APIKey
+	if err := database.DB.First(&key, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "密钥不存在"})
+		return
+	}
+	middleware.AuditBefore(c, key)
+
+	if key.RevokedAt == nil {
+		database.DB.Model(&key).Update("revoked_at", time.Now())
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已吊销"})
+}
+
+func validAPIKeyScope(scope string) bool {
+	for _, s := range middleware.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============ 审计日志 ============
+
+// 查询审计日志
+func GetAuditEntries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.AuditEntry{})
+
+	if teacherID := c.Query("teacher_id"); teacherID != "" {
+		query = query.Where("teacher_id = ?", teacherID)
+	}
+	if actor := c.Query("actor"); actor != "" {
+		query = query.Where("actor = ?", actor)
+	}
+	if route := c.Query("route"); route != "" {
+		query = query.Where("route LIKE ?", "%"+route+"%")
+	}
+	if method := c.Query("method"); method != "" {
+		query = query.Where("method = ?", method)
+	}
+	if targetID := c.Query("target_id"); targetID != "" {
+		query = query.Where("target_id = ?", targetID)
+	}
+	if from, err := time.ParseInLocation("2006-01-02", c.Query("from"), time.Local); err == nil {
+		query = query.Where("created_at >= ?", from)
+	}
+	if to, err := time.ParseInLocation("2006-01-02", c.Query("to"), time.Local); err == nil {
+		query = query.Where("created_at < ?", to.AddDate(0, 0, 1))
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var entries []models.AuditEntry
+	query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&entries)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      entries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 校验审计日志哈希链，返回第一处断裂的位置
+func VerifyAuditChain(c *gin.Context) {
+	var (
+		prevHash string
+		checked  int
+		lastID   uint
+	)
+
+	for {
+		var batch []models.AuditEntry
+		database.DB.Where("id > ?", lastID).Order("id ASC").Limit(500).Find(&batch)
+		if len(batch) == 0 {
+			break
+		}
+
+		for _, entry := range batch {
+			if entry.PrevHash != prevHash {
+				c.JSON(http.StatusOK, gin.H{"data": gin.H{
+					"valid":     false,
+					"broken_at": entry.ID,
+					"reason":    "上一条日志缺失或被修改",
+					"checked":   checked,
+				}})
+				return
+			}
+			if entry.ComputeHash() != entry.Hash {
+				c.JSON(http.StatusOK, gin.H{"data": gin.H{
+					"valid":     false,
+					"broken_at": entry.ID,
+					"reason":    "日志内容被修改",
+					"checked":   checked,
+				}})
+				return
+			}
+			prevHash = entry.Hash
+			lastID = entry.ID
+			checked++
+		}
+	}
+
+	var head models.Setting
+	database.DB.Where("`key` = ?", middleware.AuditHeadKey).First(&head)
+	if head.Value != prevHash {
+		c.JSON(http.StatusOK, gin.H{"data": gin.H{
+			"valid":     false,
+			"broken_at": lastID,
+			"reason":    "末尾日志被删除",
+			"checked":   checked,
+		}})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"valid": true, "checked": checked}})
+}
@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"net/http"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ============ 班级 ============
+
+// 班级列表（公开，用于展示端选择班级）
+func GetClasses(c *gin.Context) {
+	var classes []models.Class
+	database.DB.Order("id ASC").Find(&classes)
+	c.JSON(http.StatusOK, gin.H{"data": classes})
+}
+
+// 当前账号可管理的班级，管理员可见全部班级
+func GetAdminClasses(c *gin.Context) {
+	var classes []models.Class
+	middleware.AccessibleClasses(c).Find(&classes)
+	c.JSON(http.StatusOK, gin.H{"data": classes})
+}
+
+// 创建班级，同时生成默认段位和积分模板
+func CreateClass(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入班级名称"})
+		return
+	}
+
+	class := models.Class{Name: input.Name}
+	if err := database.DB.Create(&class).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	database.SeedClassDefaults(class.ID)
+
+	c.JSON(http.StatusCreated, gin.H{"data": class})
+}
+
+func UpdateClass(c *gin.Context) {
+	var class models.Class
+	if err := database.DB.First(&class, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "班级不存在"})
+		return
+	}
+	middleware.AuditBefore(c, class)
+
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入班级名称"})
+		return
+	}
+
+	class.Name = input.Name
+	database.DB.Save(&class)
+	c.JSON(http.StatusOK, gin.H{"data": class})
+}
+
+// 删除班级，班级内还有学生时不允许删除
+func DeleteClass(c *gin.Context) {
+	var class models.Class
+	if err := database.DB.First(&class, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "班级不存在"})
+		return
+	}
+
+	var studentCount int64
+	database.DB.Model(&models.Student{}).Where("class_id = ?", class.ID).Count(&studentCount)
+	if studentCount > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "班级内还有学生（含回收站），请先彻底删除学生"})
+		return
+	}
+
+	middleware.AuditBefore(c, class)
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.ScoreTemplate{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.CategoryLimit{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.Reward{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.ScoreRule{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.ScoreRuleRun{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.Streak{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.StreakBonus{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.Rank{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.Group{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("class_id = ?", class.ID).Delete(&models.ScoreOperation{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM teacher_classes WHERE class_id = ?", class.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&class).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 班级内（不含回收站）学生 ID 子查询
+func classStudentIDs(classID uint) *gorm.DB {
+	return database.DB.Model(&models.Student{}).Select("id").
+		Where("class_id = ? AND status <> ?", classID, models.StudentDeleted)
+}
+
+// 按 ID 查找当前班级内（不含回收站）的学生，找不到时直接返回 404
+func findClassStudent(c *gin.Context, id interface{}) (*models.Student, bool) {
+	var student models.Student
+	err := database.DB.Where("class_id = ? AND status <> ?", middleware.CurrentClassID(c), models.StudentDeleted).
+		First(&student, id).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "学生不存在"})
+		return nil, false
+	}
+	return &student, true
+}
+
+// 学生在本班在读学生中的名次
+func classRanking(student *models.Student) int64 {
+	var ranking int64
+	database.DB.Model(&models.Student{}).
+		Where("class_id = ? AND status = ? AND score > ?", student.ClassID, models.StudentActive, student.Score).
+		Count(&ranking)
+	return ranking + 1
+}
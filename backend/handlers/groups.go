@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ============ 小组 ============
+
+// 小组及组员汇总
+type groupSummary struct {
+	models.Group
+	Ranking     int              `json:"ranking"`
+	MemberCount int              `json:"member_count"`
+	MemberTotal int              `json:"member_total"` // 组员个人积分之和
+	MemberAvg   float64          `json:"member_avg"`
+	Members     []models.Student `json:"members"`
+}
+
+// 小组排行榜
+// sort=team 按小组积分（默认），sort=members 按组员积分之和，sort=avg 按组员平均分
+func GetGroupLeaderboard(c *gin.Context) {
+	policy := middleware.CurrentPrivacy(c)
+	summaries := loadGroupSummaries(middleware.CurrentClassID(c))
+
+	key := func(g groupSummary) float64 { return float64(g.Score) }
+	switch c.Query("sort") {
+	case "members":
+		key = func(g groupSummary) float64 { return float64(g.MemberTotal) }
+	case "avg":
+		key = func(g groupSummary) float64 { return g.MemberAvg }
+	}
+	sort.SliceStable(summaries, func(i, j int) bool {
+		return key(summaries[i]) > key(summaries[j])
+	})
+
+	for i := range summaries {
+		summaries[i].Ranking = i + 1
+		// 只公开前 N 名时不展示组员名单
+		if policy.TopN > 0 {
+			summaries[i].Members = []models.Student{}
+		}
+		if policy.MaskNames {
+			for j := range summaries[i].Members {
+				summaries[i].Members[j].Name = maskName(summaries[i].Members[j].Name)
+			}
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": summaries})
+}
+
+// 管理端小组列表
+func GetGroups(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"data": loadGroupSummaries(middleware.CurrentClassID(c))})
+}
+
+func CreateGroup(c *gin.Context) {
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入小组名称"})
+		return
+	}
+
+	group := models.Group{ClassID: middleware.CurrentClassID(c), Name: input.Name}
+	if err := database.DB.Create(&group).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": group})
+}
+
+func UpdateGroup(c *gin.Context) {
+	group, ok := findClassGroup(c)
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, *group)
+
+	var input struct {
+		Name string `json:"name" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入小组名称"})
+		return
+	}
+
+	database.DB.Model(group).Update("name", input.Name)
+	c.JSON(http.StatusOK, gin.H{"data": group})
+}
+
+// 删除小组，组员变为未分组；小组积分记录保留，含该小组的操作仍可撤销
+func DeleteGroup(c *gin.Context) {
+	group, ok := findClassGroup(c)
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, *group)
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Student{}).Where("group_id = ?", group.ID).Update("group_id", 0).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM teacher_groups WHERE group_id = ?", group.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(group).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 设置小组成员（整体替换），学生原来所在的小组会被调整
+func SetGroupMembers(c *gin.Context) {
+	group, ok := findClassGroup(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		StudentIDs []uint `json:"student_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var before []uint
+	database.DB.Model(&models.Student{}).Where("group_id = ?", group.ID).Pluck("id", &before)
+	middleware.AuditBefore(c, gin.H{"student_ids": before})
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.Student{}).Where("group_id = ?", group.ID).Update("group_id", 0).Error; err != nil {
+			return err
+		}
+		if len(input.StudentIDs) == 0 {
+			return nil
+		}
+		return tx.Model(&models.Student{}).
+			Where("class_id = ? AND status <> ? AND id IN ?", group.ClassID, models.StudentDeleted, input.StudentIDs).
+			Update("group_id", group.ID).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "设置成员失败"})
+		return
+	}
+
+	var members []models.Student
+	database.DB.Where("group_id = ?", group.ID).Order("student_no ASC").Find(&members)
+	c.JSON(http.StatusOK, gin.H{"data": members})
+}
+
+// 给小组加减分
+// mode=team 只计入小组积分，mode=members 分发给每个组员，mode=both（默认）两者都计
+func ModifyGroupScore(c *gin.Context) {
+	group, ok := findClassGroup(c)
+	if !ok {
+		return
+	}
+
+	var input struct {
+		TemplateID     uint   `json:"template_id"` // 指定模板时分值和分类取自模板
+		Value          int    `json:"value"`
+		Reason         string `json:"reason"`
+		Category       string `json:"category"`
+		Mode           string `json:"mode"`
+		Partial        bool   `json:"partial"`         // 组员超出分数上限时只加到上限
+		OverrideLimits bool   `json:"override_limits"` // 忽略加分上限
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !resolveScoreTemplate(c, input.TemplateID, &input.Value, &input.Reason, &input.Category) {
+		return
+	}
+	if input.OverrideLimits && !middleware.Can(c, middleware.PermScoreOverride) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有忽略加分上限的权限"})
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = models.GroupScoreBoth
+	}
+	if input.Mode != models.GroupScoreTeam && input.Mode != models.GroupScoreMembers && input.Mode != models.GroupScoreBoth {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode 只能是 team、members 或 both"})
+		return
+	}
+	if !middleware.CanScoreCategory(c, input.Category) || !middleware.CanScoreGroup(c, group.ID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该小组或分类的积分"})
+		return
+	}
+
+	var members []models.Student
+	if input.Mode != models.GroupScoreTeam {
+		database.DB.Where("group_id = ? AND status = ?", group.ID, models.StudentActive).Order("id ASC").Find(&members)
+	}
+	// 加分上限只约束组员的个人积分
+	var limits []scoring.Limit
+	if !input.OverrideLimits {
+		limits = scoreLimits(group.ClassID, input.TemplateID, input.Category)
+	}
+
+	record := models.GroupScoreRecord{
+		GroupID:  group.ID,
+		Value:    input.Value,
+		Reason:   input.Reason,
+		Category: input.Category,
+		Mode:     input.Mode,
+		Members:  len(members),
+		TermID:   activeTerm(group.ClassID).ID,
+	}
+	op := newOperation(c, models.OperationGroup, input.Value, input.Reason, input.Category)
+	op.TemplateID, op.RecordCount = input.TemplateID, len(members)
+	newScores := make(map[uint]int, len(members))
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&op).Error; err != nil {
+			return err
+		}
+		record.OperationID = op.ID
+		if input.Mode != models.GroupScoreMembers {
+			score, err := scoring.ApplyGroup(tx, group.ID, input.Value)
+			if err != nil {
+				return err
+			}
+			group.Score = score
+		}
+		for _, member := range members {
+			result, err := scoring.Apply(tx, scoring.Change{
+				StudentID:   member.ID,
+				Value:       input.Value,
+				Reason:      input.Reason,
+				Category:    input.Category,
+				OperationID: op.ID,
+				TemplateID:  op.TemplateID,
+				Actor:       op.Actor,
+				Limits:      limits,
+				Partial:     input.Partial,
+			})
+			if err != nil {
+				return err
+			}
+			newScores[member.ID] = result.NewScore
+		}
+		return tx.Create(&record).Error
+	})
+	if err != nil {
+		respondScoreError(c, err)
+		return
+	}
+
+	middleware.AuditAfter(c, gin.H{"record": record, "group_score": group.Score, "member_scores": newScores})
+	c.JSON(http.StatusOK, gin.H{"data": record, "group": group, "member_scores": newScores})
+}
+
+// 小组积分记录
+func GetGroupRecords(c *gin.Context) {
+	group, ok := findClassGroup(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.GroupScoreRecord{}).Where("group_id = ?", group.ID)
+
+	var total int64
+	query.Count(&total)
+
+	var records []models.GroupScoreRecord
+	query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&records)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      records,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 班级内所有小组及组员汇总，按小组积分降序
+func loadGroupSummaries(classID uint) []groupSummary {
+	var groups []models.Group
+	database.DB.Where("class_id = ?", classID).Order("score DESC, id ASC").Find(&groups)
+
+	var students []models.Student
+	database.DB.Where("class_id = ? AND status = ? AND group_id <> 0", classID, models.StudentActive).
+		Order("score DESC, student_no ASC").Find(&students)
+	members := make(map[uint][]models.Student)
+	for _, s := range students {
+		members[s.GroupID] = append(members[s.GroupID], s)
+	}
+
+	summaries := make([]groupSummary, len(groups))
+	for i, g := range groups {
+		summary := groupSummary{Group: g, Ranking: i + 1, Members: members[g.ID]}
+		if summary.Members == nil {
+			summary.Members = []models.Student{}
+		}
+		summary.MemberCount = len(summary.Members)
+		for _, m := range summary.Members {
+			summary.MemberTotal += m.Score
+		}
+		if summary.MemberCount > 0 {
+			summary.MemberAvg = float64(summary.MemberTotal) / float64(summary.MemberCount)
+		}
+		summaries[i] = summary
+	}
+	return summaries
+}
+
+// 读取路由中当前班级的小组，找不到时直接返回 404
+func findClassGroup(c *gin.Context) (*models.Group, bool) {
+	var group models.Group
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&group, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "小组不存在"})
+		return nil, false
+	}
+	return &group, true
+}
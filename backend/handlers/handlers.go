@@ -1,11 +1,20 @@
 package handlers
 
 import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"math/big"
 	"net/http"
+	"sort"
 	"strconv"
+	"time"
 
 	"score-backend/database"
+	"score-backend/middleware"
 	"score-backend/models"
+	"score-backend/scoring"
+	"score-backend/streaks"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -15,44 +24,37 @@ import (
 
 // 获取所有学生（带排名和段位）
 func GetStudents(c *gin.Context) {
+	policy := middleware.CurrentPrivacy(c)
+	classID := middleware.CurrentClassID(c)
+
+	query := database.DB.Where("class_id = ? AND status = ?", classID, models.StudentActive).
+		Order("score DESC, student_no ASC")
+	if policy.TopN > 0 {
+		query = query.Limit(policy.TopN)
+	}
 	var students []models.Student
-	database.DB.Order("score DESC, student_no ASC").Find(&students)
+	query.Find(&students)
 
-	var ranks []models.Rank
-	database.DB.Order("min_score DESC").Find(&ranks)
+	ranks := loadRanks(classID)
 
+	// score 即经验值（xp），决定段位和排名；coins 为可消费的积分币
 	type StudentWithRank struct {
 		models.Student
-		Ranking  int    `json:"ranking"`
-		RankName string `json:"rank_name"`
-		RankColor string `json:"rank_color"`
-		RankIcon string `json:"rank_icon"`
-		NextRank string `json:"next_rank"`
-		NextRankScore int `json:"next_rank_score"`
+		XP      int `json:"xp"`
+		Ranking int `json:"ranking"`
+		rankInfo
 	}
 
 	result := make([]StudentWithRank, len(students))
 	for i, s := range students {
-		result[i] = StudentWithRank{
-			Student: s,
-			Ranking: i + 1,
-		}
-		// 计算段位
-		for _, r := range ranks {
-			if s.Score >= r.MinScore {
-				result[i].RankName = r.Name
-				result[i].RankColor = r.Color
-				result[i].RankIcon = r.Icon
-				break
-			}
+		if policy.MaskNames {
+			s.Name = maskName(s.Name)
 		}
-		// 计算下一段位
-		for j := len(ranks) - 1; j >= 0; j-- {
-			if ranks[j].MinScore > s.Score {
-				result[i].NextRank = ranks[j].Name
-				result[i].NextRankScore = ranks[j].MinScore - s.Score
-				break
-			}
+		result[i] = StudentWithRank{
+			Student:  s,
+			XP:       s.Score,
+			Ranking:  i + 1,
+			rankInfo: resolveRank(s.Score, ranks),
 		}
 	}
 
@@ -61,55 +63,46 @@ func GetStudents(c *gin.Context) {
 
 // 获取单个学生详情
 func GetStudent(c *gin.Context) {
+	policy := middleware.CurrentPrivacy(c)
 	id := c.Param("id")
 	var student models.Student
-	if err := database.DB.First(&student, id).Error; err != nil {
+	err := database.DB.Where("class_id = ? AND status = ?", middleware.CurrentClassID(c), models.StudentActive).
+		First(&student, id).Error
+	if err != nil || !studentVisible(policy, student) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "学生不存在"})
 		return
 	}
+	if policy.MaskNames {
+		student.Name = maskName(student.Name)
+	}
 
 	// 获取积分记录
 	var records []models.ScoreRecord
-	database.DB.Where("student_id = ?", id).Order("created_at DESC").Limit(50).Find(&records)
-
-	// 获取排名
-	var ranking int64
-	database.DB.Model(&models.Student{}).Where("score > ?", student.Score).Count(&ranking)
-
-	// 获取段位信息
-	var ranks []models.Rank
-	database.DB.Order("min_score DESC").Find(&ranks)
-
-	var rankName, rankColor, rankIcon, nextRank string
-	var nextRankScore int
-
-	for _, r := range ranks {
-		if student.Score >= r.MinScore {
-			rankName = r.Name
-			rankColor = r.Color
-			rankIcon = r.Icon
-			break
-		}
+	query := database.DB.Where("student_id = ? AND term_id = ?", student.ID, activeTerm(student.ClassID).ID)
+	if policy.HideNegative {
+		query = query.Where("value >= 0")
 	}
-
-	for j := len(ranks) - 1; j >= 0; j-- {
-		if ranks[j].MinScore > student.Score {
-			nextRank = ranks[j].Name
-			nextRankScore = ranks[j].MinScore - student.Score
-			break
-		}
+	if policy.HideReversed {
+		query = query.Where("status = ?", models.RecordActive)
 	}
+	query.Order("created_at DESC").Limit(50).Find(&records)
+
+	// 获取段位信息
+	rank := resolveRank(student.Score, loadRanks(student.ClassID))
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": gin.H{
 			"student":         student,
+			"xp":              student.Score,
+			"coins":           student.Coins,
 			"records":         records,
-			"ranking":         ranking + 1,
-			"rank_name":       rankName,
-			"rank_color":      rankColor,
-			"rank_icon":       rankIcon,
-			"next_rank":       nextRank,
-			"next_rank_score": nextRankScore,
+			"ranking":         classRanking(&student),
+			"rank_name":       rank.RankName,
+			"rank_color":      rank.RankColor,
+			"rank_icon":       rank.RankIcon,
+			"next_rank":       rank.NextRank,
+			"next_rank_score": rank.NextRankScore,
+			"streaks":         streaks.ForStudent(student, time.Now()),
 		},
 	})
 }
@@ -122,19 +115,63 @@ func SearchStudent(c *gin.Context) {
 		return
 	}
 
+	policy := middleware.CurrentPrivacy(c)
+
+	// 隐藏姓名时只允许按学号搜索
+	classID := middleware.CurrentClassID(c)
+	query := database.DB.Where("class_id = ? AND status = ?", classID, models.StudentActive)
+	if policy.MaskNames {
+		query = query.Where("student_no LIKE ?", "%"+keyword+"%")
+	} else {
+		query = query.Where("name LIKE ? OR student_no LIKE ?", "%"+keyword+"%", "%"+keyword+"%")
+	}
+	if ids := visibleStudentIDs(policy, classID); ids != nil {
+		query = query.Where("id IN ?", ids)
+	}
 	var students []models.Student
-	database.DB.Where("name LIKE ? OR student_no LIKE ?", "%"+keyword+"%", "%"+keyword+"%").Find(&students)
+	query.Find(&students)
+
+	if policy.MaskNames {
+		for i := range students {
+			students[i].Name = maskName(students[i].Name)
+		}
+	}
 
 	c.JSON(http.StatusOK, gin.H{"data": students})
 }
 
+// 管理端学生名单（不受公开隐私策略影响）
+// 默认不含回收站中的学生，可用 status 参数筛选
+func GetAdminStudents(c *gin.Context) {
+	query := database.DB.Where("class_id = ?", middleware.CurrentClassID(c))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	} else {
+		query = query.Where("status <> ?", models.StudentDeleted)
+	}
+	var students []models.Student
+	query.Order("student_no ASC").Find(&students)
+
+	type adminStudent struct {
+		models.Student
+		HasPin bool `json:"has_pin"`
+	}
+	result := make([]adminStudent, len(students))
+	for i, s := range students {
+		result[i] = adminStudent{Student: s, HasPin: s.PinHash != ""}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
 // 创建学生
 func CreateStudent(c *gin.Context) {
-	var student models.Student
-	if err := c.ShouldBindJSON(&student); err != nil {
+	var input studentInput
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	student := input.student(middleware.CurrentClassID(c))
 
 	if err := database.DB.Create(&student).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
@@ -144,12 +181,25 @@ func CreateStudent(c *gin.Context) {
 	c.JSON(http.StatusCreated, gin.H{"data": student})
 }
 
+// 新建学生时可以填写的字段；积分、积分币等只能通过积分记录变动
+type studentInput struct {
+	StudentNo string `json:"student_no"`
+	Name      string `json:"name"`
+}
+
+func (input studentInput) student(classID uint) models.Student {
+	return models.Student{
+		ClassID:   classID,
+		StudentNo: input.StudentNo,
+		Name:      input.Name,
+		Status:    models.StudentActive,
+	}
+}
+
 // 更新学生
 func UpdateStudent(c *gin.Context) {
-	id := c.Param("id")
-	var student models.Student
-	if err := database.DB.First(&student, id).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "学生不存在"})
+	student, ok := findClassStudent(c, c.Param("id"))
+	if !ok {
 		return
 	}
 
@@ -162,45 +212,274 @@ func UpdateStudent(c *gin.Context) {
 		return
 	}
 
-	database.DB.Model(&student).Updates(models.Student{
+	middleware.AuditBefore(c, *student)
+	database.DB.Model(student).Updates(models.Student{
 		StudentNo: input.StudentNo,
 		Name:      input.Name,
 	})
+	middleware.AuditAfter(c, student)
 
 	c.JSON(http.StatusOK, gin.H{"data": student})
 }
 
-// 删除学生
+// 删除学生：移入回收站，积分记录保留，可以恢复
 func DeleteStudent(c *gin.Context) {
-	id := c.Param("id")
+	student, ok := findClassStudent(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, student)
+
+	if err := moveToRecycleBin([]uint{student.ID}); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已移入回收站"})
+}
+
+// 批量删除学生（移入回收站）
+func BatchDeleteStudents(c *gin.Context) {
+	var input struct {
+		StudentIDs []uint `json:"student_ids" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
 
-	// 先删除相关的积分记录
-	database.DB.Where("student_id = ?", id).Delete(&models.ScoreRecord{})
+	// 只删除当前班级内的学生
+	var students []models.Student
+	database.DB.Where("class_id = ? AND id IN ? AND status <> ?", middleware.CurrentClassID(c), input.StudentIDs, models.StudentDeleted).
+		Find(&students)
+	middleware.AuditBefore(c, students)
+	ids := make([]uint, len(students))
+	for i, student := range students {
+		ids[i] = student.ID
+	}
 
-	if err := database.DB.Delete(&models.Student{}, id).Error; err != nil {
+	if err := moveToRecycleBin(ids); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
 		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+	c.JSON(http.StatusOK, gin.H{"message": "已移入回收站", "deleted": len(students)})
+}
+
+// 修改学生状态（在读、转出、毕业），非在读学生不参与排名，也不能再登录学生端
+// 家长仍可查看孩子的历史记录
+func UpdateStudentStatus(c *gin.Context) {
+	student, ok := findClassStudent(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var input struct {
+		Status string `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidStudentStatus(input.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "状态不合法"})
+		return
+	}
+
+	middleware.AuditBefore(c, gin.H{"status": student.Status})
+	if err := database.DB.Model(student).Update("status", input.Status).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "修改失败"})
+		return
+	}
+	if input.Status != models.StudentActive {
+		middleware.RevokeSessions(models.SessionKindStudent, student.ID)
+	}
+	database.DB.First(student, student.ID)
+	middleware.AuditAfter(c, gin.H{"status": input.Status})
+	c.JSON(http.StatusOK, gin.H{"data": student})
+}
+
+// 回收站：当前班级已删除的学生及其积分记录数
+func GetRecycleBin(c *gin.Context) {
+	var students []models.Student
+	database.DB.Where("class_id = ? AND status = ?", middleware.CurrentClassID(c), models.StudentDeleted).
+		Order("deleted_at DESC").Find(&students)
+
+	type deletedStudent struct {
+		models.Student
+		RecordCount int64 `json:"record_count"`
+	}
+	result := make([]deletedStudent, len(students))
+	for i, s := range students {
+		result[i] = deletedStudent{Student: s}
+		database.DB.Model(&models.ScoreRecord{}).Where("student_id = ?", s.ID).Count(&result[i].RecordCount)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// 从回收站恢复学生，积分和记录原样恢复
+func RestoreStudent(c *gin.Context) {
+	student, ok := findDeletedStudent(c)
+	if !ok {
+		return
+	}
+
+	database.DB.Model(student).Updates(map[string]interface{}{
+		"status":     models.StudentActive,
+		"deleted_at": nil,
+	})
+	student.Status, student.DeletedAt = models.StudentActive, nil
+	c.JSON(http.StatusOK, gin.H{"data": student})
+}
+
+// 彻底删除回收站中的学生及其积分记录，不可恢复
+func PurgeStudent(c *gin.Context) {
+	student, ok := findDeletedStudent(c)
+	if !ok {
+		return
+	}
+
+	var recordCount int64
+	database.DB.Model(&models.ScoreRecord{}).Where("student_id = ?", student.ID).Count(&recordCount)
+	middleware.AuditBefore(c, gin.H{"student": student, "record_count": recordCount})
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("student_id = ?", student.ID).Delete(&models.ScoreRecord{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("student_id = ?", student.ID).Delete(&models.Redemption{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("student_id = ?", student.ID).Delete(&models.StreakBonus{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Exec("DELETE FROM parent_students WHERE student_id = ?", student.ID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(student).Error
+	})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "删除失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已彻底删除"})
+}
+
+// 把学生移入回收站，并让学生登录会话失效
+func moveToRecycleBin(ids []uint) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	err := database.DB.Model(&models.Student{}).Where("id IN ?", ids).Updates(map[string]interface{}{
+		"status":     models.StudentDeleted,
+		"deleted_at": time.Now(),
+	}).Error
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		middleware.RevokeSessions(models.SessionKindStudent, id)
+	}
+	return nil
+}
+
+func findDeletedStudent(c *gin.Context) (*models.Student, bool) {
+	var student models.Student
+	err := database.DB.Where("class_id = ? AND status = ?", middleware.CurrentClassID(c), models.StudentDeleted).
+		First(&student, c.Param("id")).Error
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "回收站中没有该学生"})
+		return nil, false
+	}
+	return &student, true
 }
 
 // 批量创建学生
 func BatchCreateStudents(c *gin.Context) {
 	var input struct {
-		Students []models.Student `json:"students"`
+		Students []studentInput `json:"students"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	students := make([]models.Student, len(input.Students))
+	for i, s := range input.Students {
+		students[i] = s.student(middleware.CurrentClassID(c))
+	}
 
-	if err := database.DB.Create(&input.Students).Error; err != nil {
+	if err := database.DB.Create(&students).Error; err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "批量创建失败"})
 		return
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"data": input.Students})
+	c.JSON(http.StatusCreated, gin.H{"data": students})
+}
+
+// 批量生成学生登录 PIN，明文只在本次响应中返回
+// 未指定 student_ids 时为所有学生生成
+func GenerateStudentPins(c *gin.Context) {
+	var input struct {
+		StudentIDs []uint `json:"student_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query := database.DB.Where("class_id = ? AND status <> ?", middleware.CurrentClassID(c), models.StudentDeleted).
+		Order("student_no ASC")
+	if len(input.StudentIDs) > 0 {
+		query = query.Where("id IN ?", input.StudentIDs)
+	}
+	var students []models.Student
+	query.Find(&students)
+
+	type studentPin struct {
+		StudentID uint   `json:"student_id"`
+		StudentNo string `json:"student_no"`
+		Name      string `json:"name"`
+		Pin       string `json:"pin"`
+	}
+	result := make([]studentPin, 0, len(students))
+	ids := make([]uint, 0, len(students))
+	for _, student := range students {
+		pin, err := randomPin()
+		if err == nil {
+			err = student.SetPin(pin)
+		}
+		if err == nil {
+			err = database.DB.Model(&student).Update("pin_hash", student.PinHash).Error
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成 PIN 失败"})
+			return
+		}
+		// 旧 PIN 登录的会话一并失效
+		middleware.RevokeSessions(models.SessionKindStudent, student.ID)
+
+		result = append(result, studentPin{
+			StudentID: student.ID,
+			StudentNo: student.StudentNo,
+			Name:      student.Name,
+			Pin:       pin,
+		})
+		ids = append(ids, student.ID)
+	}
+	middleware.AuditAfter(c, gin.H{"student_ids": ids})
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// 6 位数字 PIN
+func randomPin() (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%06d", n.Int64()), nil
 }
 
 // ============ 积分操作 ============
@@ -208,87 +487,449 @@ func BatchCreateStudents(c *gin.Context) {
 // 加减积分
 func ModifyScore(c *gin.Context) {
 	var input struct {
-		StudentID uint   `json:"student_id" binding:"required"`
-		Value     int    `json:"value" binding:"required"`
-		Reason    string `json:"reason"`
-		Category  string `json:"category"`
+		StudentID      uint   `json:"student_id" binding:"required"`
+		TemplateID     uint   `json:"template_id"` // 指定模板时分值和分类取自模板
+		Value          int    `json:"value"`
+		Reason         string `json:"reason"`
+		Category       string `json:"category"`
+		Balance        string `json:"balance"`         // both（默认）/ xp / coins
+		Partial        bool   `json:"partial"`         // 超出分数上限时只加到上限
+		OverrideLimits bool   `json:"override_limits"` // 忽略加分上限
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !resolveScoreTemplate(c, input.TemplateID, &input.Value, &input.Reason, &input.Category) {
+		return
+	}
+	if input.Balance != "" && !models.ValidBalance(input.Balance) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "balance 只能是 both、xp 或 coins"})
+		return
+	}
+	if input.OverrideLimits && !middleware.Can(c, middleware.PermScoreOverride) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有忽略加分上限的权限"})
+		return
+	}
+	if !middleware.CanScoreCategory(c, input.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该分类的积分"})
+		return
+	}
 
-	var student models.Student
-	if err := database.DB.First(&student, input.StudentID).Error; err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "学生不存在"})
+	student, ok := findClassStudent(c, input.StudentID)
+	if !ok {
+		return
+	}
+	if !middleware.CanScoreGroup(c, student.GroupID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该小组学生的积分"})
+		return
+	}
+	if student.Status != models.StudentActive {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该学生不是在读状态"})
 		return
 	}
 
-	// 更新积分
-	database.DB.Model(&student).Update("score", student.Score+input.Value)
+	var limits []scoring.Limit
+	if !input.OverrideLimits {
+		limits = scoreLimits(student.ClassID, input.TemplateID, input.Category)
+	}
 
-	// 创建记录
-	record := models.ScoreRecord{
-		StudentID: input.StudentID,
-		Value:     input.Value,
-		Reason:    input.Reason,
-		Category:  input.Category,
+	var result *scoring.Result
+	op := newOperation(c, models.OperationSingle, input.Value, input.Reason, input.Category)
+	op.TemplateID, op.RecordCount = input.TemplateID, 1
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(&op).Error; err != nil {
+			return err
+		}
+		var err error
+		result, err = scoring.Apply(tx, scoring.Change{
+			StudentID:   student.ID,
+			Value:       input.Value,
+			Reason:      input.Reason,
+			Category:    input.Category,
+			OperationID: op.ID,
+			TemplateID:  op.TemplateID,
+			Actor:       op.Actor,
+			Limits:      limits,
+			Partial:     input.Partial,
+			Balance:     input.Balance,
+		})
+		return err
+	})
+	if err != nil {
+		respondScoreError(c, err)
+		return
 	}
-	database.DB.Create(&record)
 
-	c.JSON(http.StatusOK, gin.H{"data": record, "new_score": student.Score + input.Value})
+	middleware.AuditTarget(c, strconv.Itoa(int(student.ID)))
+	middleware.AuditBefore(c, gin.H{"score": result.OldScore})
+	middleware.AuditAfter(c, gin.H{"score": result.NewScore, "record": result.Record, "override_limits": input.OverrideLimits})
+
+	c.JSON(http.StatusOK, gin.H{"data": result.Record, "new_score": result.NewScore, "coins": result.Coins, "capped": result.Capped})
+}
+
+// 批量加分模式
+const (
+	batchAtomic     = "atomic"      // 全部成功才提交，任一失败整体回滚（默认）
+	batchBestEffort = "best_effort" // 每个学生单独提交，失败的跳过
+)
+
+// 批量加分中单个学生的结果
+type batchScoreResult struct {
+	StudentID   uint   `json:"student_id"`
+	Name        string `json:"name,omitempty"`
+	Applied     bool   `json:"applied"`
+	OldScore    int    `json:"old_score"`
+	NewScore    int    `json:"new_score"`
+	Value       int    `json:"value"`            // 实际加减的分值
+	Capped      bool   `json:"capped,omitempty"` // 受加分上限限制，只加了一部分
+	OldRank     string `json:"old_rank,omitempty"`
+	NewRank     string `json:"new_rank,omitempty"`
+	RankChanged bool   `json:"rank_changed"`
+	OldRanking  int64  `json:"old_ranking,omitempty"`
+	NewRanking  int64  `json:"new_ranking,omitempty"`
+	RecordID    uint   `json:"record_id,omitempty"`
+	Error       string `json:"error,omitempty"`
 }
 
 // 批量加减积分
+// mode=atomic 时任一学生失败则全部不生效；mode=best_effort 时逐个执行
+// 两种模式都返回每个学生的结果（新积分、段位和名次变化、失败原因）
 func BatchModifyScore(c *gin.Context) {
 	var input struct {
-		StudentIDs []uint `json:"student_ids" binding:"required"`
-		Value      int    `json:"value" binding:"required"`
-		Reason     string `json:"reason"`
-		Category   string `json:"category"`
+		StudentIDs     []uint `json:"student_ids" binding:"required"`
+		TemplateID     uint   `json:"template_id"`
+		Value          int    `json:"value"`
+		Reason         string `json:"reason"`
+		Category       string `json:"category"`
+		Mode           string `json:"mode"`
+		Balance        string `json:"balance"`
+		Partial        bool   `json:"partial"`
+		OverrideLimits bool   `json:"override_limits"`
 	}
 	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	if !resolveScoreTemplate(c, input.TemplateID, &input.Value, &input.Reason, &input.Category) {
+		return
+	}
+	if input.Balance != "" && !models.ValidBalance(input.Balance) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "balance 只能是 both、xp 或 coins"})
+		return
+	}
+	if input.OverrideLimits && !middleware.Can(c, middleware.PermScoreOverride) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "没有忽略加分上限的权限"})
+		return
+	}
+	if input.Mode == "" {
+		input.Mode = batchAtomic
+	}
+	if input.Mode != batchAtomic && input.Mode != batchBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "mode 只能是 atomic 或 best_effort"})
+		return
+	}
+	if !middleware.CanScoreCategory(c, input.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该分类的积分"})
+		return
+	}
 
-	for _, studentID := range input.StudentIDs {
-		var student models.Student
-		if err := database.DB.First(&student, studentID).Error; err != nil {
+	classID := middleware.CurrentClassID(c)
+	var students []models.Student
+	database.DB.Where("class_id = ? AND id IN ?", classID, input.StudentIDs).Find(&students)
+	byID := make(map[uint]models.Student, len(students))
+	for _, s := range students {
+		byID[s.ID] = s
+	}
+
+	// 去重后按 ID 升序加锁，避免并发批量操作互相死锁
+	results := make(map[uint]*batchScoreResult)
+	var order []uint
+	for _, id := range input.StudentIDs {
+		if _, ok := results[id]; ok {
 			continue
 		}
+		item := &batchScoreResult{StudentID: id}
+		if student, ok := byID[id]; !ok {
+			item.Error = scoring.ErrStudentNotFound.Error()
+		} else {
+			item.Name = student.Name
+			item.OldScore, item.NewScore = student.Score, student.Score
+			if !middleware.CanScoreGroup(c, student.GroupID) {
+				item.Error = "无权操作该小组学生的积分"
+			}
+		}
+		results[id] = item
+		order = append(order, id)
+	}
+	ids := append([]uint(nil), order...)
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	ranks := loadRanks(classID)
+	oldRankings := make(map[uint]int64)
+	for _, id := range ids {
+		if student, ok := byID[id]; ok {
+			oldRankings[id] = classRanking(&student)
+		}
+	}
 
-		database.DB.Model(&student).Update("score", student.Score+input.Value)
+	var limits []scoring.Limit
+	if !input.OverrideLimits {
+		limits = scoreLimits(classID, input.TemplateID, input.Category)
+	}
+	op := newOperation(c, models.OperationBatch, input.Value, input.Reason, input.Category)
+	op.TemplateID = input.TemplateID
+	apply := func(tx *gorm.DB, item *batchScoreResult) error {
+		result, err := scoring.Apply(tx, scoring.Change{
+			StudentID:   item.StudentID,
+			Value:       input.Value,
+			Reason:      input.Reason,
+			Category:    input.Category,
+			OperationID: op.ID,
+			TemplateID:  op.TemplateID,
+			Actor:       op.Actor,
+			Limits:      limits,
+			Partial:     input.Partial,
+			Balance:     input.Balance,
+		})
+		if err != nil {
+			item.Error = err.Error()
+			return err
+		}
+		item.OldScore, item.NewScore = result.OldScore, result.NewScore
+		item.Value, item.Capped = result.Record.Value, result.Capped
+		item.RecordID = result.Record.ID
+		return nil
+	}
 
-		record := models.ScoreRecord{
-			StudentID: studentID,
-			Value:     input.Value,
-			Reason:    input.Reason,
-			Category:  input.Category,
+	failed := 0
+	if input.Mode == batchAtomic {
+		for _, id := range ids {
+			if results[id].Error != "" {
+				failed++
+			}
+		}
+		if failed == 0 {
+			op.RecordCount = len(ids)
+			err := database.DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Create(&op).Error; err != nil {
+					return err
+				}
+				for _, id := range ids {
+					if err := apply(tx, results[id]); err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+			if err != nil {
+				failed = len(ids)
+			}
+		}
+		if failed > 0 {
+			// 整体回滚，所有学生保持原积分
+			for _, id := range ids {
+				item := results[id]
+				item.NewScore, item.RecordID = item.OldScore, 0
+				item.Value, item.Capped = 0, false
+			}
+			op.ID = 0
+		}
+	} else {
+		if err := database.DB.Create(&op).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "积分操作失败"})
+			return
+		}
+		for _, id := range ids {
+			item := results[id]
+			if item.Error == "" {
+				database.DB.Transaction(func(tx *gorm.DB) error { return apply(tx, item) })
+			}
+			if item.Error != "" {
+				failed++
+			}
+		}
+		// 没有任何学生成功时不保留空操作
+		if applied := len(ids) - failed; applied > 0 {
+			database.DB.Model(&op).Update("record_count", applied)
+		} else {
+			database.DB.Delete(&op)
+			op.ID = 0
 		}
-		database.DB.Create(&record)
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "批量操作成功"})
+	list := make([]*batchScoreResult, len(order))
+	for i, id := range order {
+		item := results[id]
+		item.Applied = item.Error == "" && (input.Mode == batchBestEffort || failed == 0)
+		if _, ok := byID[id]; ok {
+			oldRank, newRank := resolveRank(item.OldScore, ranks), resolveRank(item.NewScore, ranks)
+			item.OldRank, item.NewRank = oldRank.RankName, newRank.RankName
+			item.RankChanged = item.OldRank != item.NewRank
+			item.OldRanking = oldRankings[id]
+			student := models.Student{ClassID: classID, Score: item.NewScore}
+			item.NewRanking = classRanking(&student)
+		}
+		list[i] = item
+	}
+
+	middleware.AuditAfter(c, gin.H{"mode": input.Mode, "value": input.Value, "category": input.Category, "operation_id": op.ID,
+		"override_limits": input.OverrideLimits, "results": list})
+
+	status, message := http.StatusOK, "批量操作成功"
+	switch {
+	case failed > 0 && input.Mode == batchAtomic:
+		status, message = http.StatusUnprocessableEntity, "部分学生无法操作，已全部回滚"
+	case failed > 0 && failed == len(order):
+		status, message = http.StatusUnprocessableEntity, "批量操作全部失败"
+	case failed > 0:
+		message = fmt.Sprintf("批量操作部分成功，%d 名学生失败", failed)
+	}
+	c.JSON(status, gin.H{"message": message, "mode": input.Mode, "failed": failed, "operation_id": op.ID, "data": list})
 }
 
-// 撤销积分操作
+// 撤销积分记录：追加一条冲正记录，原记录保留并标记为已撤销
 func UndoScoreRecord(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason"` // 撤销原因
+	}
+	c.ShouldBindJSON(&input)
+
 	id := c.Param("id")
 	var record models.ScoreRecord
-	if err := database.DB.First(&record, id).Error; err != nil {
+	err := database.DB.Where("student_id IN (?)", classStudentIDs(middleware.CurrentClassID(c))).
+		First(&record, id).Error
+	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "记录不存在"})
 		return
 	}
+	if record.Status != models.RecordActive {
+		c.JSON(http.StatusConflict, gin.H{"error": "该记录已撤销或是冲正记录，不能撤销"})
+		return
+	}
+	if isRedemptionRecord(record.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "兑换奖励的记录请通过取消兑换退回"})
+		return
+	}
+	if !middleware.CanScoreCategory(c, record.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该分类的积分"})
+		return
+	}
+	var student models.Student
+	database.DB.First(&student, record.StudentID)
+	if !middleware.CanScoreGroup(c, student.GroupID) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该小组学生的积分"})
+		return
+	}
+	// 已结束学期的成绩已经存档，不能再撤销
+	if record.TermID != activeTerm(student.ClassID).ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该记录属于已结束的学期，不能撤销"})
+		return
+	}
+
+	middleware.AuditBefore(c, record)
+
+	_, actor := middleware.CurrentActor(c)
+	var result *scoring.Result
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = scoring.Revert(tx, &record, input.Reason, actor)
+		return err
+	})
+	if err != nil {
+		respondScoreError(c, err)
+		return
+	}
+
+	middleware.AuditAfter(c, gin.H{"record": record, "reversal": result.Record, "score": result.NewScore})
+	c.JSON(http.StatusOK, gin.H{"message": "撤销成功", "data": result.Record, "new_score": result.NewScore})
+}
+
+// 把积分操作的错误转换为响应
+func respondScoreError(c *gin.Context, err error) {
+	var limitErr *scoring.LimitError
+	switch {
+	case errors.Is(err, scoring.ErrStudentNotFound), errors.Is(err, scoring.ErrRecordNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, scoring.ErrStudentInactive):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, scoring.ErrBelowFloor), errors.Is(err, scoring.ErrNotEnoughCoins),
+		errors.Is(err, scoring.ErrOutOfStock), errors.Is(err, scoring.ErrRedeemLimit):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+	case errors.Is(err, scoring.ErrRewardUnavailable):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, scoring.ErrOperationUndone), errors.Is(err, scoring.ErrRedemptionHandled):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.As(err, &limitErr):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error(), "limit": limitErr})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "积分操作失败"})
+	}
+}
+
+// 积分流水（管理端）：包含已撤销的记录和冲正记录，已撤销的记录附带撤销人和撤销原因
+func GetScoreLedger(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	classID := middleware.CurrentClassID(c)
+
+	query := database.DB.Model(&models.ScoreRecord{}).Preload("Student").
+		Where("student_id IN (?)", database.DB.Model(&models.Student{}).Select("id").Where("class_id = ?", classID))
+	if c.Query("term_id") != "" {
+		query = query.Where("term_id = ?", requestedTermID(c, classID))
+	}
+	if studentID := c.Query("student_id"); studentID != "" {
+		query = query.Where("student_id = ?", studentID)
+	}
+	if operationID := c.Query("operation_id"); operationID != "" {
+		query = query.Where("operation_id = ?", operationID)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
 
-	// 恢复积分
-	database.DB.Model(&models.Student{}).Where("id = ?", record.StudentID).
-		Update("score", gorm.Expr("score - ?", record.Value))
+	var total int64
+	query.Count(&total)
 
-	// 删除记录
-	database.DB.Delete(&record)
+	var records []models.ScoreRecord
+	query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&records)
 
-	c.JSON(http.StatusOK, gin.H{"message": "撤销成功"})
+	var reversalIDs []uint
+	for _, r := range records {
+		if r.ReversalID != 0 {
+			reversalIDs = append(reversalIDs, r.ReversalID)
+		}
+	}
+	reversals := make(map[uint]models.ScoreRecord)
+	if len(reversalIDs) > 0 {
+		var list []models.ScoreRecord
+		database.DB.Where("id IN ?", reversalIDs).Find(&list)
+		for _, r := range list {
+			reversals[r.ID] = r
+		}
+	}
+
+	type ledgerEntry struct {
+		models.ScoreRecord
+		Reversal *models.ScoreRecord `json:"reversal,omitempty"`
+	}
+	entries := make([]ledgerEntry, len(records))
+	for i, r := range records {
+		entries[i] = ledgerEntry{ScoreRecord: r}
+		if reversal, ok := reversals[r.ReversalID]; ok {
+			entries[i].Reversal = &reversal
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      entries,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
 }
 
 // 获取积分记录
@@ -298,8 +939,22 @@ func GetScoreRecords(c *gin.Context) {
 	studentID := c.Query("student_id")
 	category := c.Query("category")
 
-	query := database.DB.Model(&models.ScoreRecord{}).Preload("Student")
+	policy := middleware.CurrentPrivacy(c)
+	classID := middleware.CurrentClassID(c)
 
+	query := database.DB.Model(&models.ScoreRecord{}).Preload("Student").
+		Where("student_id IN (?)", classStudentIDs(classID)).
+		Where("term_id = ?", requestedTermID(c, classID))
+
+	if policy.HideNegative {
+		query = query.Where("value >= 0")
+	}
+	if policy.HideReversed {
+		query = query.Where("status = ?", models.RecordActive)
+	}
+	if ids := visibleStudentIDs(policy, classID); ids != nil {
+		query = query.Where("student_id IN ?", ids)
+	}
 	if studentID != "" {
 		query = query.Where("student_id = ?", studentID)
 	}
@@ -316,6 +971,12 @@ func GetScoreRecords(c *gin.Context) {
 		Limit(pageSize).
 		Find(&records)
 
+	if policy.MaskNames {
+		for i := range records {
+			records[i].Student.Name = maskName(records[i].Student.Name)
+		}
+	}
+
 	c.JSON(http.StatusOK, gin.H{
 		"data":      records,
 		"total":     total,
@@ -326,9 +987,81 @@ func GetScoreRecords(c *gin.Context) {
 
 // ============ 积分模板 ============
 
+// 请求指定了 template_id 时用模板的分值和分类覆盖请求（原因为空时取模板名称）
+// 未指定模板时分值不能为 0；出错时已写入响应并返回 false
+func resolveScoreTemplate(c *gin.Context, templateID uint, value *int, reason, category *string) bool {
+	if templateID == 0 {
+		if *value == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入积分或选择积分模板"})
+			return false
+		}
+		return true
+	}
+
+	var template models.ScoreTemplate
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&template, templateID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return false
+	}
+	*value, *category = template.Value, template.Category
+	if *reason == "" {
+		*reason = template.Name
+	}
+	return true
+}
+
+// 积分模板使用统计（默认当前学期），已撤销的记录不计入
+func GetTemplateStats(c *gin.Context) {
+	classID := middleware.CurrentClassID(c)
+	termID := requestedTermID(c, classID)
+
+	type templateStat struct {
+		TemplateID   uint       `json:"template_id"`
+		Name         string     `json:"name"`
+		Category     string     `json:"category"`
+		Value        int        `json:"value"`
+		Deleted      bool       `json:"deleted"` // 模板已被删除
+		Count        int64      `json:"count"`
+		Total        int64      `json:"total"`
+		StudentCount int64      `json:"student_count"`
+		LastUsedAt   *time.Time `json:"last_used_at"`
+	}
+	var stats []templateStat
+	database.DB.Model(&models.ScoreRecord{}).
+		Where("student_id IN (?) AND term_id = ? AND status = ? AND template_id <> 0", classStudentIDs(classID), termID, models.RecordActive).
+		Select("template_id, COUNT(*) as count, SUM(value) as total, COUNT(DISTINCT student_id) as student_count, MAX(created_at) as last_used_at").
+		Group("template_id").
+		Order("count DESC").
+		Scan(&stats)
+
+	var templates []models.ScoreTemplate
+	database.DB.Where("class_id = ?", classID).Find(&templates)
+	byID := make(map[uint]models.ScoreTemplate, len(templates))
+	for _, t := range templates {
+		byID[t.ID] = t
+	}
+	used := make(map[uint]bool, len(stats))
+	for i := range stats {
+		used[stats[i].TemplateID] = true
+		if t, ok := byID[stats[i].TemplateID]; ok {
+			stats[i].Name, stats[i].Category, stats[i].Value = t.Name, t.Category, t.Value
+		} else {
+			stats[i].Deleted = true
+		}
+	}
+	// 本学期还没用过的模板也列出来
+	for _, t := range templates {
+		if !used[t.ID] {
+			stats = append(stats, templateStat{TemplateID: t.ID, Name: t.Name, Category: t.Category, Value: t.Value})
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": gin.H{"term_id": termID, "templates": stats}})
+}
+
 func GetTemplates(c *gin.Context) {
 	var templates []models.ScoreTemplate
-	database.DB.Find(&templates)
+	database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).Find(&templates)
 	c.JSON(http.StatusOK, gin.H{"data": templates})
 }
 
@@ -338,6 +1071,8 @@ func CreateTemplate(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	template.ID = 0
+	template.ClassID = middleware.CurrentClassID(c)
 
 	database.DB.Create(&template)
 	c.JSON(http.StatusCreated, gin.H{"data": template})
@@ -346,31 +1081,84 @@ func CreateTemplate(c *gin.Context) {
 func UpdateTemplate(c *gin.Context) {
 	id := c.Param("id")
 	var template models.ScoreTemplate
-	if err := database.DB.First(&template, id).Error; err != nil {
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&template, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
 		return
 	}
+	middleware.AuditBefore(c, template)
 
-	if err := c.ShouldBindJSON(&template); err != nil {
+	// 单独绑定，请求体不能改写 ID 和班级
+	input := struct {
+		Name     string `json:"name"`
+		Value    int    `json:"value"`
+		Category string `json:"category"`
+		models.ScoreLimit
+	}{template.Name, template.Value, template.Category, template.ScoreLimit}
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	template.Name, template.Value, template.Category, template.ScoreLimit = input.Name, input.Value, input.Category, input.ScoreLimit
 
 	database.DB.Save(&template)
+	middleware.AuditAfter(c, template)
 	c.JSON(http.StatusOK, gin.H{"data": template})
 }
 
 func DeleteTemplate(c *gin.Context) {
 	id := c.Param("id")
-	database.DB.Delete(&models.ScoreTemplate{}, id)
+	var template models.ScoreTemplate
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&template, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "模板不存在"})
+		return
+	}
+	middleware.AuditBefore(c, template)
+	database.DB.Delete(&template)
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
 
 // ============ 段位配置 ============
 
+// 段位信息
+type rankInfo struct {
+	RankName      string `json:"rank_name"`
+	RankColor     string `json:"rank_color"`
+	RankIcon      string `json:"rank_icon"`
+	NextRank      string `json:"next_rank"`
+	NextRankScore int    `json:"next_rank_score"`
+}
+
+// 按积分从高到低加载班级的段位
+func loadRanks(classID uint) []models.Rank {
+	var ranks []models.Rank
+	database.DB.Where("class_id = ?", classID).Order("min_score DESC").Find(&ranks)
+	return ranks
+}
+
+// 计算积分对应的段位和下一段位，ranks 需按 min_score 降序
+func resolveRank(score int, ranks []models.Rank) rankInfo {
+	var info rankInfo
+	for _, r := range ranks {
+		if score >= r.MinScore {
+			info.RankName = r.Name
+			info.RankColor = r.Color
+			info.RankIcon = r.Icon
+			break
+		}
+	}
+	for j := len(ranks) - 1; j >= 0; j-- {
+		if ranks[j].MinScore > score {
+			info.NextRank = ranks[j].Name
+			info.NextRankScore = ranks[j].MinScore - score
+			break
+		}
+	}
+	return info
+}
+
 func GetRanks(c *gin.Context) {
 	var ranks []models.Rank
-	database.DB.Order("min_score ASC").Find(&ranks)
+	database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).Order("min_score ASC").Find(&ranks)
 	c.JSON(http.StatusOK, gin.H{"data": ranks})
 }
 
@@ -380,6 +1168,8 @@ func CreateRank(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	rank.ID = 0
+	rank.ClassID = middleware.CurrentClassID(c)
 
 	database.DB.Create(&rank)
 	c.JSON(http.StatusCreated, gin.H{"data": rank})
@@ -388,42 +1178,58 @@ func CreateRank(c *gin.Context) {
 func UpdateRank(c *gin.Context) {
 	id := c.Param("id")
 	var rank models.Rank
-	if err := database.DB.First(&rank, id).Error; err != nil {
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&rank, id).Error; err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "段位不存在"})
 		return
 	}
+	middleware.AuditBefore(c, rank)
 
-	if err := c.ShouldBindJSON(&rank); err != nil {
+	input := struct {
+		Name      string `json:"name"`
+		MinScore  int    `json:"min_score"`
+		Color     string `json:"color"`
+		Icon      string `json:"icon"`
+		SortOrder int    `json:"sort_order"`
+	}{rank.Name, rank.MinScore, rank.Color, rank.Icon, rank.SortOrder}
+	if err := c.ShouldBindJSON(&input); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	rank.Name, rank.MinScore, rank.Color, rank.Icon, rank.SortOrder = input.Name, input.MinScore, input.Color, input.Icon, input.SortOrder
 
 	database.DB.Save(&rank)
+	middleware.AuditAfter(c, rank)
 	c.JSON(http.StatusOK, gin.H{"data": rank})
 }
 
 func DeleteRank(c *gin.Context) {
 	id := c.Param("id")
-	database.DB.Delete(&models.Rank{}, id)
+	var rank models.Rank
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&rank, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "段位不存在"})
+		return
+	}
+	middleware.AuditBefore(c, rank)
+	database.DB.Delete(&rank)
 	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
 }
 
 // ============ 系统管理 ============
 
-// 重置所有积分
-func ResetAllScores(c *gin.Context) {
-	database.DB.Model(&models.Student{}).Update("score", 0)
-	database.DB.Delete(&models.ScoreRecord{}, "1=1")
-	c.JSON(http.StatusOK, gin.H{"message": "重置成功"})
-}
-
 // 获取统计数据
 func GetStatistics(c *gin.Context) {
+	classID := middleware.CurrentClassID(c)
+
 	var totalStudents int64
-	database.DB.Model(&models.Student{}).Count(&totalStudents)
+	database.DB.Model(&models.Student{}).Where("class_id = ? AND status = ?", classID, models.StudentActive).Count(&totalStudents)
 
+	termID := requestedTermID(c, classID)
+
+	// 已撤销的记录和冲正记录互相抵消，不计入统计；只统计计入经验值的记录
 	var totalRecords int64
-	database.DB.Model(&models.ScoreRecord{}).Count(&totalRecords)
+	database.DB.Model(&models.ScoreRecord{}).
+		Where("student_id IN (?) AND term_id = ? AND status = ? AND balance <> ?", classStudentIDs(classID), termID, models.RecordActive, models.BalanceCoins).
+		Count(&totalRecords)
 
 	type CategoryStat struct {
 		Category string `json:"category"`
@@ -433,15 +1239,17 @@ func GetStatistics(c *gin.Context) {
 
 	var categoryStats []CategoryStat
 	database.DB.Model(&models.ScoreRecord{}).
+		Where("student_id IN (?) AND term_id = ? AND status = ? AND balance <> ?", classStudentIDs(classID), termID, models.RecordActive, models.BalanceCoins).
 		Select("category, COUNT(*) as count, SUM(value) as total").
 		Group("category").
 		Scan(&categoryStats)
 
 	c.JSON(http.StatusOK, gin.H{
 		"data": gin.H{
-			"total_students":  totalStudents,
-			"total_records":   totalRecords,
-			"category_stats":  categoryStats,
+			"term_id":        termID,
+			"total_students": totalStudents,
+			"total_records":  totalRecords,
+			"category_stats": categoryStats,
 		},
 	})
 }
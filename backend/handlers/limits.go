@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"net/http"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm/clause"
+)
+
+// ============ 加分上限 ============
+
+// 班级的分类加分上限
+func GetCategoryLimits(c *gin.Context) {
+	var limits []models.CategoryLimit
+	database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).Order("category ASC").Find(&limits)
+	c.JSON(http.StatusOK, gin.H{"data": limits})
+}
+
+// 设置某个分类的加分上限（已存在时覆盖）
+func SaveCategoryLimit(c *gin.Context) {
+	var input models.CategoryLimit
+	if err := c.ShouldBindJSON(&input); err != nil || input.Category == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入分类名称"})
+		return
+	}
+	if input.DailyTimes < 0 || input.WeeklyTimes < 0 || input.DailyPoints < 0 || input.WeeklyPoints < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "上限不能为负数"})
+		return
+	}
+
+	limit := models.CategoryLimit{ClassID: middleware.CurrentClassID(c), Category: input.Category, ScoreLimit: input.ScoreLimit}
+	err := database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "class_id"}, {Name: "category"}},
+		DoUpdates: clause.AssignmentColumns([]string{"daily_times", "weekly_times", "daily_points", "weekly_points"}),
+	}).Create(&limit).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存失败"})
+		return
+	}
+
+	database.DB.Where("class_id = ? AND category = ?", limit.ClassID, limit.Category).First(&limit)
+	middleware.AuditAfter(c, limit)
+	c.JSON(http.StatusOK, gin.H{"data": limit})
+}
+
+func DeleteCategoryLimit(c *gin.Context) {
+	var limit models.CategoryLimit
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&limit, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "上限设置不存在"})
+		return
+	}
+	middleware.AuditBefore(c, limit)
+	database.DB.Delete(&limit)
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 本次加分适用的上限：所用模板的上限和分类上限
+func scoreLimits(classID, templateID uint, category string) []scoring.Limit {
+	var limits []scoring.Limit
+	if templateID != 0 {
+		var template models.ScoreTemplate
+		if database.DB.Where("class_id = ?", classID).First(&template, templateID).Error == nil {
+			limits = append(limits, scoring.Limit{
+				ScoreLimit: template.ScoreLimit,
+				Name:       "模板「" + template.Name + "」",
+				TemplateID: template.ID,
+			})
+		}
+	}
+	var categoryLimit models.CategoryLimit
+	if category != "" && database.DB.Where("class_id = ? AND category = ?", classID, category).First(&categoryLimit).Error == nil {
+		limits = append(limits, scoring.Limit{
+			ScoreLimit: categoryLimit.ScoreLimit,
+			Name:       "分类「" + category + "」",
+			Category:   category,
+		})
+	}
+	return limits
+}
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/scoring"
+	"score-backend/streaks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============ 学生个人中心 ============
+
+// 当前学生的基本信息、排名和段位
+func GetMe(c *gin.Context) {
+	student := middleware.CurrentStudent(c)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"student": student,
+			"ranking": classRanking(student),
+			"rank":    resolveRank(student.Score, loadRanks(student.ClassID)),
+		},
+	})
+}
+
+// 当前学生的积分记录
+func GetMyRecords(c *gin.Context) {
+	student := middleware.CurrentStudent(c)
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.ScoreRecord{}).Where("student_id = ?", student.ID)
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var records []models.ScoreRecord
+	query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&records)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      records,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 段位进度和最近几周的积分变化
+func GetMyProgress(c *gin.Context) {
+	student := middleware.CurrentStudent(c)
+	weeks, _ := strconv.Atoi(c.DefaultQuery("weeks", "8"))
+	if weeks <= 0 || weeks > 52 {
+		weeks = 8
+	}
+
+	ranks := loadRanks(student.ClassID)
+	rank := resolveRank(student.Score, ranks)
+
+	// 当前段位到下一段位的完成百分比
+	percent := 100
+	if rank.NextRank != "" {
+		floor := 0
+		for _, r := range ranks {
+			if student.Score >= r.MinScore {
+				floor = r.MinScore
+				break
+			}
+		}
+		span := student.Score + rank.NextRankScore - floor
+		if span > 0 {
+			percent = (student.Score - floor) * 100 / span
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"score":   student.Score,
+			"coins":   student.Coins,
+			"rank":    rank,
+			"percent": percent,
+			"weeks":   weeklySummaries(student.ID, weeks),
+		},
+	})
+}
+
+// 每周积分汇总
+type weekSummary struct {
+	WeekStart  string         `json:"week_start"`
+	Gained     int            `json:"gained"`
+	Lost       int            `json:"lost"`
+	Records    int            `json:"records"`
+	Categories map[string]int `json:"categories"`
+}
+
+// 最近 weeks 周（含本周）的积分汇总，按时间升序
+func weeklySummaries(studentID uint, weeks int) []weekSummary {
+	start := weekStart(time.Now()).AddDate(0, 0, -7*(weeks-1))
+	var records []models.ScoreRecord
+	database.DB.Where("student_id = ? AND status = ? AND balance <> ? AND created_at >= ?", studentID, models.RecordActive, models.BalanceCoins, start).
+		Find(&records)
+
+	summaries := make([]weekSummary, weeks)
+	for i := range summaries {
+		summaries[i].WeekStart = start.AddDate(0, 0, 7*i).Format("2006-01-02")
+		summaries[i].Categories = make(map[string]int)
+	}
+	for _, r := range records {
+		i := int(weekStart(r.CreatedAt).Sub(start).Hours() / (24 * 7))
+		if i < 0 || i >= weeks {
+			continue
+		}
+		if r.Value > 0 {
+			summaries[i].Gained += r.Value
+		} else {
+			summaries[i].Lost += -r.Value
+		}
+		summaries[i].Records++
+		summaries[i].Categories[r.Category] += r.Value
+	}
+	return summaries
+}
+
+// 连续加分天数、连续无扣分周数和班级设置的连续记录
+func GetMyStreaks(c *gin.Context) {
+	student := middleware.CurrentStudent(c)
+	now := time.Now()
+
+	// 内置的两项：每天有加分、每周没有扣分
+	builtin := func(period, kind string) streaks.Result {
+		streak := models.Streak{Period: period, Kind: kind}
+		results, _ := streaks.Compute(streak, []models.Student{*student}, now)
+		return results[student.ID]
+	}
+	positive := builtin(models.StreakDay, models.StreakGain)
+	clean := builtin(models.StreakWeek, models.StreakClean)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"positive_days":      positive.Current,
+			"best_positive_days": positive.Best,
+			"clean_weeks":        clean.Current,
+			"best_clean_weeks":   clean.Best,
+			"streaks":            streaks.ForStudent(*student, now),
+		},
+	})
+}
+
+// 所在周的周一零点
+func weekStart(t time.Time) time.Time {
+	return scoring.WeekStart(t)
+}
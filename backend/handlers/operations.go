@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ============ 积分操作 ============
+
+// 当前请求对应的积分操作，操作者取当前教师或 API 密钥
+func newOperation(c *gin.Context, kind string, value int, reason, category string) models.ScoreOperation {
+	teacherID, actor := middleware.CurrentActor(c)
+	return models.ScoreOperation{
+		ClassID:   middleware.CurrentClassID(c),
+		Kind:      kind,
+		Value:     value,
+		Reason:    reason,
+		Category:  category,
+		TeacherID: teacherID,
+		Actor:     actor,
+	}
+}
+
+// 积分操作列表，最新的在前
+func GetScoreOperations(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.ScoreOperation{}).Where("class_id = ?", middleware.CurrentClassID(c))
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var operations []models.ScoreOperation
+	query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&operations)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      operations,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 整体撤销一次积分操作（单次、批量或小组加分），所有学生在同一事务中扣回
+func UndoScoreOperation(c *gin.Context) {
+	var input struct {
+		Reason string `json:"reason"` // 撤销原因
+	}
+	c.ShouldBindJSON(&input)
+
+	classID := middleware.CurrentClassID(c)
+	var op models.ScoreOperation
+	if err := database.DB.Where("class_id = ?", classID).First(&op, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "操作不存在"})
+		return
+	}
+	if op.UndoneAt != nil {
+		c.JSON(http.StatusConflict, gin.H{"error": "该操作已撤销"})
+		return
+	}
+	if !middleware.CanScoreCategory(c, op.Category) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该分类的积分"})
+		return
+	}
+
+	// 小组积分记录的小组和学生记录所在的小组都要检查（Pluck 会清空传入的切片，需分别读取）
+	var recordGroupIDs, memberGroupIDs []uint
+	database.DB.Model(&models.GroupScoreRecord{}).Where("operation_id = ?", op.ID).Pluck("group_id", &recordGroupIDs)
+	database.DB.Model(&models.Student{}).
+		Where("id IN (?)", database.DB.Model(&models.ScoreRecord{}).Select("student_id").Where("operation_id = ?", op.ID)).
+		Pluck("group_id", &memberGroupIDs)
+	for _, groupID := range append(recordGroupIDs, memberGroupIDs...) {
+		if !middleware.CanScoreGroup(c, groupID) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "无权操作该小组学生的积分"})
+			return
+		}
+	}
+
+	// 已结束学期的成绩已经存档，不能再撤销
+	termID := activeTerm(classID).ID
+	var archived int64
+	database.DB.Model(&models.ScoreRecord{}).Where("operation_id = ? AND term_id <> ?", op.ID, termID).Count(&archived)
+	if archived == 0 {
+		database.DB.Model(&models.GroupScoreRecord{}).Where("operation_id = ? AND term_id <> ?", op.ID, termID).Count(&archived)
+	}
+	if archived > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该操作属于已结束的学期，不能撤销"})
+		return
+	}
+
+	middleware.AuditTarget(c, strconv.Itoa(int(op.ID)))
+	middleware.AuditBefore(c, op)
+
+	_, actor := middleware.CurrentActor(c)
+	var results []scoring.Result
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		results, err = scoring.RevertOperation(tx, &op, input.Reason, actor)
+		return err
+	})
+	if err != nil {
+		respondScoreError(c, err)
+		return
+	}
+
+	middleware.AuditAfter(c, gin.H{"operation": op, "results": results})
+	c.JSON(http.StatusOK, gin.H{"message": "撤销成功", "data": op, "results": results})
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"score-backend/config"
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// 内存 SQLite，只用于不依赖 MySQL 行锁的接口测试
+func openHandlerTestDB(t *testing.T) *gorm.DB {
+	db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("打开数据库失败: %v", err)
+	}
+	err = db.AutoMigrate(&models.Class{}, &models.Group{}, &models.Teacher{}, &models.Session{}, &models.Student{},
+		&models.ScoreRecord{}, &models.GroupScoreRecord{}, &models.ScoreOperation{}, &models.Term{})
+	if err != nil {
+		t.Fatalf("迁移失败: %v", err)
+	}
+	database.DB = db
+	return db
+}
+
+// 只负责部分小组的科任老师不能撤销其他小组的整组加分（team 模式没有学生记录）
+func TestUndoTeamOperationRequiresGroupAccess(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := openHandlerTestDB(t)
+
+	class := models.Class{Name: "一班"}
+	db.Create(&class)
+	own := models.Group{ClassID: class.ID, Name: "第一组"}
+	other := models.Group{ClassID: class.ID, Name: "第二组"}
+	db.Create(&own)
+	db.Create(&other)
+	teacher := models.Teacher{Username: "subject", Name: "科任老师", Role: models.RoleSubject, Categories: "纪律",
+		Classes: []models.Class{class}, Groups: []models.Group{own}}
+	db.Create(&teacher)
+
+	op := models.ScoreOperation{ClassID: class.ID, Kind: models.OperationGroup, Value: 5, Reason: "整组加分", Category: "纪律"}
+	db.Create(&op)
+	db.Create(&models.GroupScoreRecord{GroupID: other.ID, Value: 5, Category: "纪律", Mode: models.GroupScoreTeam,
+		OperationID: op.ID, Status: models.RecordActive})
+
+	cfg := &config.Config{SessionTTL: time.Hour, LockoutMaxAttempts: 5, LockoutBase: time.Second, LockoutMax: time.Minute}
+	token, _, err := middleware.NewSession(models.SessionKindTeacher, teacher.ID, "127.0.0.1", cfg.SessionTTL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	guard := middleware.NewLoginGuard(cfg, middleware.NewMemoryAttemptStore())
+	r.POST("/operations/:id/undo", middleware.AdminAuth(guard), middleware.AdminClass(),
+		middleware.Require(middleware.PermScoreWrite), UndoScoreOperation)
+
+	req := httptest.NewRequest(http.MethodPost, "/operations/"+strconv.Itoa(int(op.ID))+"/undo", nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("X-Class-ID", strconv.Itoa(int(class.ID)))
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status = %d, want 403, body = %s", w.Code, w.Body.String())
+	}
+	db.First(&op, op.ID)
+	if op.UndoneAt != nil {
+		t.Fatal("操作不应被撤销")
+	}
+}
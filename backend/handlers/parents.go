@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"math/big"
+	"net/http"
+	"strconv"
+	"time"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 邀请码有效期
+const parentInviteTTL = 7 * 24 * time.Hour
+
+// ============ 家长管理（教师端） ============
+
+// 为学生生成家长邀请码
+func CreateParentInvite(c *gin.Context) {
+	student, ok := findClassStudent(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	code, err := randomInviteCode()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成邀请码失败"})
+		return
+	}
+	invite := models.ParentInvite{
+		Code:      code,
+		StudentID: student.ID,
+		ExpiresAt: time.Now().Add(parentInviteTTL),
+	}
+	if teacher := middleware.CurrentTeacher(c); teacher != nil {
+		invite.CreatedBy = teacher.ID
+	}
+	if err := database.DB.Create(&invite).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "生成邀请码失败"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": invite})
+}
+
+// 查看学生已绑定的家长
+func GetStudentParents(c *gin.Context) {
+	student, ok := findClassStudent(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	var parents []models.Parent
+	database.DB.Joins("JOIN parent_students ON parent_students.parent_id = parents.id").
+		Where("parent_students.student_id = ?", student.ID).
+		Find(&parents)
+
+	c.JSON(http.StatusOK, gin.H{"data": parents})
+}
+
+// 解除家长与学生的绑定
+func UnlinkParent(c *gin.Context) {
+	student, ok := findClassStudent(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	var parent models.Parent
+	if err := database.DB.First(&parent, c.Param("parent_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "家长不存在"})
+		return
+	}
+
+	if err := database.DB.Model(&parent).Association("Students").Delete(student); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "解除绑定失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已解除绑定"})
+}
+
+// ============ 家长端 ============
+
+// 当前家长绑定的孩子及其段位
+func GetChildren(c *gin.Context) {
+	var children []models.Student
+	database.DB.Model(middleware.CurrentParent(c)).
+		Where("students.status <> ?", models.StudentDeleted).
+		Association("Students").Find(&children)
+
+	// 孩子可能在不同班级，段位按各自班级计算
+	ranks := make(map[uint][]models.Rank)
+	type childWithRank struct {
+		models.Student
+		rankInfo
+	}
+	result := make([]childWithRank, len(children))
+	for i, child := range children {
+		if _, ok := ranks[child.ClassID]; !ok {
+			ranks[child.ClassID] = loadRanks(child.ClassID)
+		}
+		result[i] = childWithRank{Student: child, rankInfo: resolveRank(child.Score, ranks[child.ClassID])}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+// 单个孩子的详情：排名和段位
+func GetChild(c *gin.Context) {
+	child, ok := currentChild(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"student": child,
+			"ranking": classRanking(child),
+			"rank":    resolveRank(child.Score, loadRanks(child.ClassID)),
+		},
+	})
+}
+
+// 孩子的积分记录
+func GetChildRecords(c *gin.Context) {
+	child, ok := currentChild(c)
+	if !ok {
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.ScoreRecord{}).Where("student_id = ?", child.ID)
+	if category := c.Query("category"); category != "" {
+		query = query.Where("category = ?", category)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var records []models.ScoreRecord
+	query.Order("created_at DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&records)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      records,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 孩子最近几周的积分汇总
+func GetChildWeekly(c *gin.Context) {
+	child, ok := currentChild(c)
+	if !ok {
+		return
+	}
+	weeks, _ := strconv.Atoi(c.DefaultQuery("weeks", "4"))
+	if weeks <= 0 || weeks > 52 {
+		weeks = 4
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": weeklySummaries(child.ID, weeks)})
+}
+
+// 读取路由中的孩子，并确认已与当前家长绑定
+func currentChild(c *gin.Context) (*models.Student, bool) {
+	var child models.Student
+	err := database.DB.Model(middleware.CurrentParent(c)).
+		Where("students.id = ? AND students.status <> ?", c.Param("id"), models.StudentDeleted).
+		Association("Students").Find(&child)
+	if err != nil || child.ID == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "学生不存在"})
+		return nil, false
+	}
+	return &child, true
+}
+
+// 8 位邀请码，去掉容易混淆的字符
+func randomInviteCode() (string, error) {
+	const alphabet = "ABCDEFGHJKMNPQRSTUVWXYZ23456789"
+	code := make([]byte, 8)
+	for i := range code {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(alphabet))))
+		if err != nil {
+			return "", err
+		}
+		code[i] = alphabet[n.Int64()]
+	}
+	return string(code), nil
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+
+	"score-backend/middleware"
+	"score-backend/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============ 积分上下限 ============
+
+// 当前班级的积分上下限策略
+func GetScorePolicy(c *gin.Context) {
+	policy, err := settings.LoadScorePolicy(middleware.CurrentClassID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": policy})
+}
+
+// 更新积分上下限策略，floor 或 ceiling 为 null 表示不限
+// 只影响之后的积分变动，已有积分不会被调整
+func UpdateScorePolicy(c *gin.Context) {
+	var policy settings.ScorePolicy
+	if err := c.ShouldBindJSON(&policy); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if policy.FloorMode == "" {
+		policy.FloorMode = settings.FloorClamp
+	}
+	if policy.FloorMode != settings.FloorClamp && policy.FloorMode != settings.FloorReject && policy.FloorMode != settings.FloorDebt {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "floor_mode 只能是 clamp、reject 或 debt"})
+		return
+	}
+	if policy.Floor != nil && policy.Ceiling != nil && *policy.Floor > *policy.Ceiling {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "积分下限不能高于上限"})
+		return
+	}
+
+	classID := middleware.CurrentClassID(c)
+	before, _ := settings.LoadScorePolicy(classID)
+	middleware.AuditBefore(c, before)
+	if err := settings.Set(settings.ScorePolicyKey(classID), policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存设置失败"})
+		return
+	}
+	middleware.AuditAfter(c, policy)
+	c.JSON(http.StatusOK, gin.H{"data": policy})
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============ 隐私设置 ============
+
+// 当前班级的隐私策略
+func GetPrivacySettings(c *gin.Context) {
+	policy, err := settings.LoadPrivacy(middleware.CurrentClassID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": policy})
+}
+
+// 更新隐私策略，regenerate_token 为 true 时重新生成班级展示令牌
+func UpdatePrivacySettings(c *gin.Context) {
+	policy, err := settings.LoadPrivacy(middleware.CurrentClassID(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "读取设置失败"})
+		return
+	}
+
+	var input struct {
+		MaskNames           bool `json:"mask_names"`
+		TopN                int  `json:"top_n"`
+		HideNegative        bool `json:"hide_negative"`
+		HideReversed        bool `json:"hide_reversed"`
+		RequireDisplayToken bool `json:"require_display_token"`
+		RegenerateToken     bool `json:"regenerate_token"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if input.TopN < 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "top_n 不能为负数"})
+		return
+	}
+
+	policy.MaskNames = input.MaskNames
+	policy.TopN = input.TopN
+	policy.HideNegative = input.HideNegative
+	policy.HideReversed = input.HideReversed
+	policy.RequireDisplayToken = input.RequireDisplayToken
+	if input.RegenerateToken || (policy.RequireDisplayToken && policy.DisplayToken == "") {
+		token, err := randomInviteCode()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "生成令牌失败"})
+			return
+		}
+		policy.DisplayToken = token
+	}
+
+	if err := settings.Set(settings.PrivacyKey(middleware.CurrentClassID(c)), policy); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "保存设置失败"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"data": policy})
+}
+
+// 姓名只保留第一个字，例如 "张三丰" -> "张**"
+func maskName(name string) string {
+	runes := []rune(name)
+	if len(runes) <= 1 {
+		return name
+	}
+	return string(runes[0]) + strings.Repeat("*", len(runes)-1)
+}
+
+// 隐私策略限制了前 N 名时返回班级内可公开的学生 ID，不限制时返回 nil
+func visibleStudentIDs(policy settings.PrivacyPolicy, classID uint) []uint {
+	if policy.TopN <= 0 {
+		return nil
+	}
+	ids := []uint{}
+	database.DB.Model(&models.Student{}).
+		Where("class_id = ? AND status = ?", classID, models.StudentActive).
+		Order("score DESC, student_no ASC").
+		Limit(policy.TopN).
+		Pluck("id", &ids)
+	return ids
+}
+
+func studentVisible(policy settings.PrivacyPolicy, student models.Student) bool {
+	ids := visibleStudentIDs(policy, student.ClassID)
+	if ids == nil {
+		return true
+	}
+	for _, visible := range ids {
+		if visible == student.ID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,314 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/scoring"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// ============ 奖励兑换 ============
+
+// 奖励商品的可编辑字段
+type rewardInput struct {
+	Name            string `json:"name" binding:"required"`
+	Description     string `json:"description"`
+	Cost            int    `json:"cost"`
+	Stock           int    `json:"stock"` // -1 表示不限
+	PerStudentLimit int    `json:"per_student_limit"`
+	Active          *bool  `json:"active"` // 不传时为上架
+}
+
+func (input rewardInput) validate() string {
+	switch {
+	case input.Cost < 0:
+		return "兑换所需积分币不能为负数"
+	case input.Stock < -1:
+		return "库存只能是 -1（不限）或非负数"
+	case input.PerStudentLimit < 0:
+		return "每人兑换次数不能为负数"
+	}
+	return ""
+}
+
+// 可兑换的奖励（上架中）
+func GetRewards(c *gin.Context) {
+	var rewards []models.Reward
+	database.DB.Where("class_id = ? AND active = ?", middleware.CurrentClassID(c), true).Order("cost ASC, id ASC").Find(&rewards)
+	c.JSON(http.StatusOK, gin.H{"data": rewards})
+}
+
+// 管理端奖励列表（含已下架）
+func GetAdminRewards(c *gin.Context) {
+	var rewards []models.Reward
+	database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).Order("id ASC").Find(&rewards)
+	c.JSON(http.StatusOK, gin.H{"data": rewards})
+}
+
+func CreateReward(c *gin.Context) {
+	var input rewardInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入奖励名称"})
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	reward := models.Reward{
+		ClassID:         middleware.CurrentClassID(c),
+		Name:            input.Name,
+		Description:     input.Description,
+		Cost:            input.Cost,
+		Stock:           input.Stock,
+		PerStudentLimit: input.PerStudentLimit,
+		Active:          input.Active == nil || *input.Active,
+	}
+	if err := database.DB.Create(&reward).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	c.JSON(http.StatusCreated, gin.H{"data": reward})
+}
+
+func UpdateReward(c *gin.Context) {
+	reward, ok := findClassReward(c)
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, *reward)
+
+	var input rewardInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入奖励名称"})
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	reward.Name, reward.Description = input.Name, input.Description
+	reward.Cost, reward.Stock, reward.PerStudentLimit = input.Cost, input.Stock, input.PerStudentLimit
+	if input.Active != nil {
+		reward.Active = *input.Active
+	}
+	database.DB.Save(reward)
+	middleware.AuditAfter(c, *reward)
+	c.JSON(http.StatusOK, gin.H{"data": reward})
+}
+
+// 删除奖励，还有待兑现的兑换时不允许删除；已有的兑换记录保留奖励名称
+func DeleteReward(c *gin.Context) {
+	reward, ok := findClassReward(c)
+	if !ok {
+		return
+	}
+
+	var pending int64
+	database.DB.Model(&models.Redemption{}).Where("reward_id = ? AND status = ?", reward.ID, models.RedemptionPending).Count(&pending)
+	if pending > 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "该奖励还有待兑现的兑换，请先处理"})
+		return
+	}
+
+	middleware.AuditBefore(c, *reward)
+	database.DB.Delete(reward)
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 教师替学生兑换奖励
+func RedeemReward(c *gin.Context) {
+	reward, ok := findClassReward(c)
+	if !ok {
+		return
+	}
+	var input struct {
+		StudentID uint `json:"student_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	student, ok := findClassStudent(c, input.StudentID)
+	if !ok {
+		return
+	}
+
+	_, actor := middleware.CurrentActor(c)
+	redeem(c, reward.ID, student.ID, actor)
+}
+
+// 学生自己兑换奖励
+func RedeemMyReward(c *gin.Context) {
+	student := middleware.CurrentStudent(c)
+	var reward models.Reward
+	if err := database.DB.Where("class_id = ?", student.ClassID).First(&reward, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "奖励不存在"})
+		return
+	}
+	redeem(c, reward.ID, student.ID, "student:"+student.StudentNo)
+}
+
+func redeem(c *gin.Context, rewardID, studentID uint, actor string) {
+	var redemption *models.Redemption
+	var result *scoring.Result
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		redemption, result, err = scoring.Redeem(tx, rewardID, studentID, actor)
+		return err
+	})
+	if err != nil {
+		respondScoreError(c, err)
+		return
+	}
+
+	middleware.AuditTarget(c, strconv.Itoa(int(studentID)))
+	middleware.AuditAfter(c, gin.H{"redemption": redemption, "coins": result.Coins})
+	c.JSON(http.StatusCreated, gin.H{"message": "兑换成功，等待老师兑现", "data": redemption, "coins": result.Coins})
+}
+
+// 兑换记录，可按状态和学生筛选
+func GetRedemptions(c *gin.Context) {
+	query := database.DB.Model(&models.Redemption{}).Where("class_id = ?", middleware.CurrentClassID(c))
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if studentID := c.Query("student_id"); studentID != "" {
+		query = query.Where("student_id = ?", studentID)
+	}
+	respondRedemptions(c, query.Preload("Student"))
+}
+
+// 当前学生的兑换记录
+func GetMyRedemptions(c *gin.Context) {
+	student := middleware.CurrentStudent(c)
+	respondRedemptions(c, database.DB.Model(&models.Redemption{}).Where("student_id = ?", student.ID))
+}
+
+// 孩子的兑换记录
+func GetChildRedemptions(c *gin.Context) {
+	child, ok := currentChild(c)
+	if !ok {
+		return
+	}
+	respondRedemptions(c, database.DB.Model(&models.Redemption{}).Where("student_id = ?", child.ID))
+}
+
+func respondRedemptions(c *gin.Context, query *gorm.DB) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	var total int64
+	query.Count(&total)
+
+	var redemptions []models.Redemption
+	query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&redemptions)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      redemptions,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+// 兑现奖励
+func FulfillRedemption(c *gin.Context) {
+	redemption, ok := findClassRedemption(c)
+	if !ok {
+		return
+	}
+	var input struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&input)
+
+	_, actor := middleware.CurrentActor(c)
+	now := time.Now()
+	// 条件更新保证并发下只有一次兑现或取消生效
+	result := database.DB.Model(&models.Redemption{}).
+		Where("id = ? AND status = ?", redemption.ID, models.RedemptionPending).
+		Updates(map[string]interface{}{
+			"status":     models.RedemptionFulfilled,
+			"handled_by": actor,
+			"handled_at": now,
+			"note":       input.Note,
+		})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+	if result.RowsAffected != 1 {
+		c.JSON(http.StatusConflict, gin.H{"error": scoring.ErrRedemptionHandled.Error()})
+		return
+	}
+
+	redemption.Status, redemption.HandledBy, redemption.HandledAt, redemption.Note = models.RedemptionFulfilled, actor, &now, input.Note
+	middleware.AuditAfter(c, redemption)
+	c.JSON(http.StatusOK, gin.H{"message": "已兑现", "data": redemption})
+}
+
+// 取消兑换，退回积分币和库存
+func CancelRedemption(c *gin.Context) {
+	redemption, ok := findClassRedemption(c)
+	if !ok {
+		return
+	}
+	var input struct {
+		Note string `json:"note"`
+	}
+	c.ShouldBindJSON(&input)
+
+	_, actor := middleware.CurrentActor(c)
+	var result *scoring.Result
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		result, err = scoring.CancelRedemption(tx, redemption, input.Note, actor)
+		return err
+	})
+	if err != nil {
+		respondScoreError(c, err)
+		return
+	}
+
+	middleware.AuditAfter(c, gin.H{"redemption": redemption, "coins": result.Coins})
+	c.JSON(http.StatusOK, gin.H{"message": "已取消，积分币已退回", "data": redemption, "coins": result.Coins})
+}
+
+// 读取路由中当前班级的奖励，找不到时直接返回 404
+func findClassReward(c *gin.Context) (*models.Reward, bool) {
+	var reward models.Reward
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&reward, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "奖励不存在"})
+		return nil, false
+	}
+	return &reward, true
+}
+
+func findClassRedemption(c *gin.Context) (*models.Redemption, bool) {
+	var redemption models.Redemption
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&redemption, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "兑换记录不存在"})
+		return nil, false
+	}
+	return &redemption, true
+}
+
+// 兑换扣除的积分记录只能通过取消兑换退回
+func isRedemptionRecord(recordID uint) bool {
+	var count int64
+	database.DB.Model(&models.Redemption{}).Where("record_id = ?", recordID).Count(&count)
+	return count > 0
+}
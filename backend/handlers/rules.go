@@ -0,0 +1,225 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/scheduler"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============ 自动积分规则 ============
+
+// 自动积分规则的可编辑字段
+type ruleInput struct {
+	Name              string `json:"name" binding:"required"`
+	Weekday           int    `json:"weekday"` // -1 表示每天
+	RunAt             string `json:"run_at"`
+	Condition         string `json:"condition"` // 不传时为所有在读学生
+	ConditionCategory string `json:"condition_category"`
+	Threshold         int    `json:"threshold"`
+	Value             int    `json:"value"`
+	Reason            string `json:"reason"`
+	Category          string `json:"category"`
+	Active            *bool  `json:"active"` // 不传时为启用
+}
+
+func (input *ruleInput) validate() string {
+	if input.Condition == "" {
+		input.Condition = models.RuleAll
+	}
+	if input.Reason == "" {
+		input.Reason = input.Name
+	}
+	if _, _, ok := scheduler.ParseRunAt(input.RunAt); !ok {
+		return "运行时间格式应为 HH:MM"
+	}
+	switch {
+	case input.Weekday < -1 || input.Weekday > 6:
+		return "星期只能是 0-6（周日到周六）或 -1（每天）"
+	case input.Value == 0:
+		return "分值不能为 0"
+	case input.Condition != models.RuleAll && input.Condition != models.RuleNoDeductions && input.Condition != models.RuleMinGain:
+		return "无效的规则条件"
+	case input.Condition == models.RuleMinGain && input.Threshold <= 0:
+		return "请设置统计周期内的最低加分"
+	}
+	return ""
+}
+
+func (input ruleInput) apply(rule *models.ScoreRule) {
+	rule.Name, rule.Weekday, rule.RunAt = input.Name, input.Weekday, input.RunAt
+	rule.Condition, rule.ConditionCategory, rule.Threshold = input.Condition, input.ConditionCategory, input.Threshold
+	rule.Value, rule.Reason, rule.Category = input.Value, input.Reason, input.Category
+	if input.Active != nil {
+		rule.Active = *input.Active
+	}
+}
+
+// 规则列表，附带下一次运行时间
+func GetRules(c *gin.Context) {
+	var rules []models.ScoreRule
+	database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).Order("id ASC").Find(&rules)
+
+	now := time.Now()
+	type ruleWithNext struct {
+		models.ScoreRule
+		NextRunAt *time.Time `json:"next_run_at"`
+	}
+	result := make([]ruleWithNext, len(rules))
+	for i, rule := range rules {
+		result[i].ScoreRule = rule
+		if next, ok := scheduler.NextSlot(rule, now); ok && rule.Active {
+			result[i].NextRunAt = &next
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"data": result})
+}
+
+func CreateRule(c *gin.Context) {
+	var input ruleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入规则名称"})
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	rule := models.ScoreRule{ClassID: middleware.CurrentClassID(c), Active: true}
+	input.apply(&rule)
+	if err := database.DB.Create(&rule).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	middleware.AuditAfter(c, rule)
+	c.JSON(http.StatusCreated, gin.H{"data": rule})
+}
+
+// 修改规则；重新启用时不补跑停用期间错过的时间点
+func UpdateRule(c *gin.Context) {
+	rule, ok := findClassRule(c)
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, *rule)
+
+	var input ruleInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入规则名称"})
+		return
+	}
+	if msg := input.validate(); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	wasActive := rule.Active
+	input.apply(rule)
+	if rule.Active && !wasActive {
+		now := time.Now()
+		rule.LastRunAt = &now
+	}
+	database.DB.Save(rule)
+	middleware.AuditAfter(c, *rule)
+	c.JSON(http.StatusOK, gin.H{"data": rule})
+}
+
+// 删除规则，已产生的积分记录和运行记录保留
+func DeleteRule(c *gin.Context) {
+	rule, ok := findClassRule(c)
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, *rule)
+	database.DB.Delete(rule)
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 立即运行规则；dry_run 时只返回当前满足条件的学生，不加分
+func RunRule(c *gin.Context) {
+	rule, ok := findClassRule(c)
+	if !ok {
+		return
+	}
+	var input struct {
+		DryRun bool `json:"dry_run"`
+	}
+	c.ShouldBindJSON(&input)
+
+	now := time.Now()
+	if input.DryRun {
+		candidates, err := scheduler.Evaluate(*rule, now)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "评估规则失败"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{
+			"data":         candidates,
+			"period_start": scheduler.PeriodStart(*rule, now),
+			"at":           now,
+			"value":        rule.Value,
+		})
+		return
+	}
+
+	_, actor := middleware.CurrentActor(c)
+	run, err := scheduler.Run(*rule, now, models.RuleTriggerManual, actor)
+	if errors.Is(err, scheduler.ErrAlreadyRun) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "运行规则失败", "data": run})
+		return
+	}
+
+	middleware.AuditAfter(c, run)
+	c.JSON(http.StatusOK, gin.H{"message": "已运行，" + strconv.Itoa(run.StudentCount) + " 名学生获得积分", "data": run})
+}
+
+// 规则的运行记录，最新的在前
+func GetRuleRuns(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+
+	query := database.DB.Model(&models.ScoreRuleRun{}).Where("class_id = ?", middleware.CurrentClassID(c))
+	if ruleID := c.Query("rule_id"); ruleID != "" {
+		query = query.Where("rule_id = ?", ruleID)
+	}
+	if trigger := c.Query("trigger"); trigger != "" {
+		query = query.Where("`trigger` = ?", trigger)
+	}
+
+	var total int64
+	query.Count(&total)
+
+	var runs []models.ScoreRuleRun
+	query.Order("id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&runs)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data":      runs,
+		"total":     total,
+		"page":      page,
+		"page_size": pageSize,
+	})
+}
+
+func findClassRule(c *gin.Context) (*models.ScoreRule, bool) {
+	var rule models.ScoreRule
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&rule, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "规则不存在"})
+		return nil, false
+	}
+	return &rule, true
+}
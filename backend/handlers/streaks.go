@@ -0,0 +1,170 @@
+package handlers
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/streaks"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============ 连续记录 ============
+
+// 连续记录的可编辑字段
+type streakInput struct {
+	Name           string `json:"name" binding:"required"`
+	Period         string `json:"period"` // 不传时为 day
+	Kind           string `json:"kind"`   // 不传时为 gain
+	TemplateID     uint   `json:"template_id"`
+	Category       string `json:"category"`
+	BonusThreshold int    `json:"bonus_threshold"`
+	BonusValue     int    `json:"bonus_value"`
+	BonusRepeat    bool   `json:"bonus_repeat"`
+	Active         *bool  `json:"active"` // 不传时为启用
+}
+
+func (input *streakInput) validate(classID uint) string {
+	if input.Period == "" {
+		input.Period = models.StreakDay
+	}
+	if input.Kind == "" {
+		input.Kind = models.StreakGain
+	}
+	switch {
+	case input.Period != models.StreakDay && input.Period != models.StreakWeek:
+		return "统计周期只能是 day 或 week"
+	case input.Kind != models.StreakGain && input.Kind != models.StreakClean:
+		return "类型只能是 gain 或 clean"
+	case input.BonusThreshold < 0:
+		return "奖励阈值不能为负数"
+	case input.BonusThreshold > 0 && input.BonusValue == 0:
+		return "请设置奖励分值"
+	}
+	if input.TemplateID != 0 {
+		var count int64
+		database.DB.Model(&models.ScoreTemplate{}).Where("class_id = ? AND id = ?", classID, input.TemplateID).Count(&count)
+		if count == 0 {
+			return "积分模板不存在"
+		}
+	}
+	return ""
+}
+
+func (input streakInput) apply(streak *models.Streak) {
+	streak.Name, streak.Period, streak.Kind = input.Name, input.Period, input.Kind
+	streak.TemplateID, streak.Category = input.TemplateID, input.Category
+	streak.BonusThreshold, streak.BonusValue, streak.BonusRepeat = input.BonusThreshold, input.BonusValue, input.BonusRepeat
+	if input.Active != nil {
+		streak.Active = *input.Active
+	}
+}
+
+func GetStreaks(c *gin.Context) {
+	var list []models.Streak
+	database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).Order("id ASC").Find(&list)
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+func CreateStreak(c *gin.Context) {
+	var input streakInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入名称"})
+		return
+	}
+	classID := middleware.CurrentClassID(c)
+	if msg := input.validate(classID); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	streak := models.Streak{ClassID: classID, Active: true}
+	input.apply(&streak)
+	if err := database.DB.Create(&streak).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	middleware.AuditAfter(c, streak)
+	c.JSON(http.StatusCreated, gin.H{"data": streak})
+}
+
+func UpdateStreak(c *gin.Context) {
+	streak, ok := findClassStreak(c)
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, *streak)
+
+	var input streakInput
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "请输入名称"})
+		return
+	}
+	if msg := input.validate(streak.ClassID); msg != "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": msg})
+		return
+	}
+
+	input.apply(streak)
+	database.DB.Save(streak)
+	middleware.AuditAfter(c, *streak)
+	c.JSON(http.StatusOK, gin.H{"data": streak})
+}
+
+// 删除连续记录，已发放的奖励积分保留
+func DeleteStreak(c *gin.Context) {
+	streak, ok := findClassStreak(c)
+	if !ok {
+		return
+	}
+	middleware.AuditBefore(c, *streak)
+	database.DB.Delete(streak)
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 班级在读学生在某个连续记录上的连续情况，当前连续长的在前
+func GetStreakStandings(c *gin.Context) {
+	streak, ok := findClassStreak(c)
+	if !ok {
+		return
+	}
+
+	var students []models.Student
+	database.DB.Where("class_id = ? AND status = ?", streak.ClassID, models.StudentActive).Order("id ASC").Find(&students)
+	results, err := streaks.Compute(*streak, students, time.Now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "统计失败"})
+		return
+	}
+
+	type standing struct {
+		StudentID uint   `json:"student_id"`
+		StudentNo string `json:"student_no"`
+		Name      string `json:"name"`
+		streaks.Result
+	}
+	standings := make([]standing, len(students))
+	for i, s := range students {
+		standings[i] = standing{StudentID: s.ID, StudentNo: s.StudentNo, Name: s.Name, Result: results[s.ID]}
+	}
+	sort.SliceStable(standings, func(i, j int) bool {
+		if standings[i].Current != standings[j].Current {
+			return standings[i].Current > standings[j].Current
+		}
+		return standings[i].Best > standings[j].Best
+	})
+	c.JSON(http.StatusOK, gin.H{"data": standings})
+}
+
+func findClassStreak(c *gin.Context) (*models.Streak, bool) {
+	var streak models.Streak
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&streak, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "连续记录不存在"})
+		return nil, false
+	}
+	return &streak, true
+}
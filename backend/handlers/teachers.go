@@ -0,0 +1,186 @@
+package handlers
+
+import (
+	"net/http"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ============ 教师账号 ============
+
+// 当前登录的教师及其权限
+func GetCurrentTeacher(c *gin.Context) {
+	teacher := middleware.CurrentTeacher(c)
+	c.JSON(http.StatusOK, gin.H{
+		"data":        teacher,
+		"permissions": middleware.RolePermissions(teacher.Role),
+	})
+}
+
+func GetTeachers(c *gin.Context) {
+	var teachers []models.Teacher
+	database.DB.Preload("Classes").Preload("Groups").Order("id ASC").Find(&teachers)
+	c.JSON(http.StatusOK, gin.H{"data": teachers})
+}
+
+func CreateTeacher(c *gin.Context) {
+	var input struct {
+		Username   string `json:"username" binding:"required"`
+		Name       string `json:"name"`
+		Password   string `json:"password" binding:"required,min=6"`
+		Role       string `json:"role" binding:"required"`
+		Categories string `json:"categories"`
+		ClassIDs   []uint `json:"class_ids"`
+		GroupIDs   []uint `json:"group_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !models.ValidRole(input.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "角色不合法"})
+		return
+	}
+
+	teacher := models.Teacher{
+		Username:   input.Username,
+		Name:       input.Name,
+		Role:       input.Role,
+		Categories: input.Categories,
+	}
+	if err := teacher.SetPassword(input.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	if err := database.DB.Where("id IN ?", input.ClassIDs).Find(&teacher.Classes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	if err := database.DB.Where("id IN ?", input.GroupIDs).Find(&teacher.Groups).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败"})
+		return
+	}
+	if err := database.DB.Create(&teacher).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "创建失败，用户名可能已存在"})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"data": teacher})
+}
+
+// 更新教师信息，修改密码会吊销该教师的全部会话
+func UpdateTeacher(c *gin.Context) {
+	id := c.Param("id")
+	var teacher models.Teacher
+	if err := database.DB.Preload("Classes").Preload("Groups").First(&teacher, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "教师不存在"})
+		return
+	}
+	middleware.AuditBefore(c, teacher)
+
+	var input struct {
+		Name       string  `json:"name"`
+		Password   string  `json:"password"`
+		Role       string  `json:"role"`
+		Categories *string `json:"categories"`
+		ClassIDs   *[]uint `json:"class_ids"`
+		GroupIDs   *[]uint `json:"group_ids"`
+	}
+	if err := c.ShouldBindJSON(&input); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if input.Name != "" {
+		teacher.Name = input.Name
+	}
+	if input.Role != "" && input.Role != teacher.Role {
+		if !models.ValidRole(input.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "角色不合法"})
+			return
+		}
+		if current := middleware.CurrentTeacher(c); current != nil && current.ID == teacher.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不能修改自己的角色"})
+			return
+		}
+		teacher.Role = input.Role
+	}
+	if input.Categories != nil {
+		teacher.Categories = *input.Categories
+	}
+	if input.Password != "" {
+		if len(input.Password) < 6 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "密码至少 6 位"})
+			return
+		}
+		if err := teacher.SetPassword(input.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新失败"})
+			return
+		}
+	}
+
+	database.DB.Omit("Classes", "Groups").Save(&teacher)
+	// 传入 class_ids 时整体替换任教班级
+	if input.ClassIDs != nil {
+		var classes []models.Class
+		database.DB.Where("id IN ?", *input.ClassIDs).Find(&classes)
+		if err := database.DB.Model(&teacher).Association("Classes").Replace(classes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新班级失败"})
+			return
+		}
+	}
+	if input.GroupIDs != nil {
+		var groups []models.Group
+		database.DB.Where("id IN ?", *input.GroupIDs).Find(&groups)
+		if err := database.DB.Model(&teacher).Association("Groups").Replace(groups); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "更新小组失败"})
+			return
+		}
+	}
+	middleware.AuditAfter(c, gin.H{"teacher": teacher, "password_changed": input.Password != ""})
+	if input.Password != "" {
+		middleware.RevokeSessions(models.SessionKindTeacher, teacher.ID)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"data": teacher})
+}
+
+func DeleteTeacher(c *gin.Context) {
+	id := c.Param("id")
+	var teacher models.Teacher
+	if err := database.DB.First(&teacher, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "教师不存在"})
+		return
+	}
+	if current := middleware.CurrentTeacher(c); current != nil && current.ID == teacher.ID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "不能删除自己的账号"})
+		return
+	}
+
+	middleware.AuditBefore(c, teacher)
+	middleware.RevokeSessions(models.SessionKindTeacher, teacher.ID)
+	database.DB.Select("Classes", "Groups").Delete(&teacher)
+
+	c.JSON(http.StatusOK, gin.H{"message": "删除成功"})
+}
+
+// 吊销教师的全部会话（强制下线）
+func RevokeTeacherSessions(c *gin.Context) {
+	id := c.Param("id")
+	var teacher models.Teacher
+	if err := database.DB.First(&teacher, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "教师不存在"})
+		return
+	}
+
+	if err := middleware.RevokeSessions(models.SessionKindTeacher, teacher.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "操作失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "已吊销该教师的全部会话"})
+}
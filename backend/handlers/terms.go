@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"score-backend/database"
+	"score-backend/middleware"
+	"score-backend/models"
+	"score-backend/scoring"
+	"score-backend/settings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ============ 学期 ============
+
+var errTermClosed = errors.New("学期已结束")
+
+// 班级的学期列表（含已结束的学期）
+func GetTerms(c *gin.Context) {
+	var terms []models.Term
+	database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).Order("id DESC").Find(&terms)
+	c.JSON(http.StatusOK, gin.H{"data": terms})
+}
+
+// 已结束学期的最终排名（只读）
+func GetTermStandings(c *gin.Context) {
+	var term models.Term
+	if err := database.DB.Where("class_id = ?", middleware.CurrentClassID(c)).First(&term, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "学期不存在"})
+		return
+	}
+	if term.ClosedAt == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "学期尚未结束，请查看当前排行榜"})
+		return
+	}
+
+	policy := middleware.CurrentPrivacy(c)
+	query := database.DB.Where("term_id = ?", term.ID).Order("ranking ASC, student_no ASC")
+	if policy.TopN > 0 {
+		query = query.Limit(policy.TopN)
+	}
+	var standings []models.TermStanding
+	query.Find(&standings)
+	if policy.MaskNames {
+		for i := range standings {
+			standings[i].Name = maskName(standings[i].Name)
+		}
+	}
+
+	var groups []models.TermGroupStanding
+	database.DB.Where("term_id = ?", term.ID).Order("ranking ASC").Find(&groups)
+
+	c.JSON(http.StatusOK, gin.H{
+		"data": gin.H{
+			"term":      term,
+			"standings": standings,
+			"groups":    groups,
+		},
+	})
+}
+
+// 重置积分：结束当前学期并存档最终成绩、段位和排名，新学期从零（或更高的积分下限）开始
+// 历史积分记录保留，可以按学期查询
+func ResetAllScores(c *gin.Context) {
+	var input struct {
+		Name string `json:"name"` // 新学期名称
+	}
+	c.ShouldBindJSON(&input)
+
+	classID := middleware.CurrentClassID(c)
+	current := activeTerm(classID)
+	if input.Name == "" {
+		input.Name = time.Now().Format("2006-01-02") + " 起"
+	}
+	middleware.AuditBefore(c, current)
+
+	next := models.Term{ClassID: classID, Name: input.Name}
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		// 锁住当前学期，防止重复结束
+		var term models.Term
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&term, current.ID).Error; err != nil {
+			return err
+		}
+		if term.ClosedAt != nil {
+			return errTermClosed
+		}
+
+		var students []models.Student
+		// 锁住学生行，存档期间的积分操作等待新学期开始后再执行
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("class_id = ? AND status = ?", classID, models.StudentActive).
+			Order("score DESC, student_no ASC").Find(&students).Error
+		if err != nil {
+			return err
+		}
+		ranks := loadRanks(classID)
+		standings := make([]models.TermStanding, len(students))
+		for i, s := range students {
+			rank := resolveRank(s.Score, ranks)
+			// 同分同名次
+			ranking := i + 1
+			if i > 0 && s.Score == students[i-1].Score {
+				ranking = standings[i-1].Ranking
+			}
+			standings[i] = models.TermStanding{
+				TermID:    term.ID,
+				StudentID: s.ID,
+				StudentNo: s.StudentNo,
+				Name:      s.Name,
+				Score:     s.Score,
+				Ranking:   ranking,
+				RankName:  rank.RankName,
+				RankColor: rank.RankColor,
+				RankIcon:  rank.RankIcon,
+			}
+		}
+		if len(standings) > 0 {
+			if err := tx.Create(&standings).Error; err != nil {
+				return err
+			}
+		}
+
+		var groups []models.Group
+		if err := tx.Where("class_id = ?", classID).Order("score DESC, id ASC").Find(&groups).Error; err != nil {
+			return err
+		}
+		if len(groups) > 0 {
+			groupStandings := make([]models.TermGroupStanding, len(groups))
+			for i, g := range groups {
+				groupStandings[i] = models.TermGroupStanding{
+					TermID: term.ID, GroupID: g.ID, Name: g.Name, Score: g.Score, Ranking: i + 1,
+				}
+			}
+			if err := tx.Create(&groupStandings).Error; err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		if err := tx.Model(&term).Update("closed_at", now).Error; err != nil {
+			return err
+		}
+		next.StartedAt = now
+		if err := tx.Create(&next).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&models.Group{}).Where("class_id = ?", classID).Update("score", 0).Error; err != nil {
+			return err
+		}
+		policy, err := settings.LoadScorePolicy(classID)
+		if err != nil {
+			return err
+		}
+		// 只重置已存档的在读学生；回收站和转出、毕业的学生保留原积分
+		return tx.Model(&models.Student{}).Where("class_id = ? AND status = ?", classID, models.StudentActive).
+			Updates(map[string]interface{}{"score": policy.ResetScore(), "debt": 0}).Error
+	})
+	if errors.Is(err, errTermClosed) {
+		c.JSON(http.StatusConflict, gin.H{"error": "当前学期已被结束，请刷新后重试"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "重置失败"})
+		return
+	}
+
+	middleware.AuditAfter(c, gin.H{"closed_term_id": current.ID, "new_term": next})
+	c.JSON(http.StatusOK, gin.H{"message": "重置成功，已开启新学期", "archived_term_id": current.ID, "term": next})
+}
+
+// 班级当前未结束的学期
+func activeTerm(classID uint) models.Term {
+	return scoring.ActiveTerm(database.DB, classID)
+}
+
+// 请求中的 term_id（须属于该班级），未指定时为当前学期
+func requestedTermID(c *gin.Context, classID uint) uint {
+	if raw := c.Query("term_id"); raw != "" {
+		id, _ := strconv.ParseUint(raw, 10, 64)
+		var term models.Term
+		if database.DB.Where("class_id = ?", classID).First(&term, id).Error == nil {
+			return term.ID
+		}
+		return 0
+	}
+	return activeTerm(classID).ID
+}
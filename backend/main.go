@@ -7,6 +7,7 @@ import (
 	"score-backend/database"
 	"score-backend/handlers"
 	"score-backend/middleware"
+	"score-backend/scheduler"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-contrib/gzip"
@@ -25,6 +26,11 @@ func main() {
 	// 初始化数据库
 	database.Init(cfg)
 
+	// 自动积分规则调度
+	if cfg.SchedulerEnabled {
+		scheduler.Start()
+	}
+
 	// 创建 Gin 引擎
 	r := gin.Default()
 
@@ -35,60 +41,217 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "X-Admin-Password"},
-		ExposeHeaders:    []string{"Content-Length"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Accept", "Authorization", "X-API-Key", "X-Confirm-Token", "X-Display-Token", "X-Class-ID", "Idempotency-Key"},
+		ExposeHeaders:    []string{"Content-Length", "Idempotent-Replayed"},
 		AllowCredentials: true,
 	}))
 
+	// 登录失败计数（默认内存存储）
+	guard := middleware.NewLoginGuard(cfg, middleware.NewMemoryAttemptStore())
+	idempotent := middleware.Idempotent(cfg)
+
 	// ============ 公开API（用户端） ============
 	public := r.Group("/api")
+	{
+		// 班级列表
+		public.GET("/classes", handlers.GetClasses)
+	}
+
+	// 以下接口按班级区分（X-Class-ID 或 class_id 参数）
+	classPublic := public.Group("")
+	classPublic.Use(middleware.PublicClass(), middleware.PublicAccess())
 	{
 		// 学生列表（排行榜）
-		public.GET("/students", handlers.GetStudents)
+		classPublic.GET("/students", handlers.GetStudents)
 		// 学生详情
-		public.GET("/students/:id", handlers.GetStudent)
+		classPublic.GET("/students/:id", handlers.GetStudent)
 		// 搜索学生
-		public.GET("/students/search", handlers.SearchStudent)
+		classPublic.GET("/students/search", handlers.SearchStudent)
 		// 获取段位配置
-		public.GET("/ranks", handlers.GetRanks)
+		classPublic.GET("/ranks", handlers.GetRanks)
 		// 获取积分模板（用于展示分类）
-		public.GET("/templates", handlers.GetTemplates)
+		classPublic.GET("/templates", handlers.GetTemplates)
 		// 获取积分记录
-		public.GET("/records", handlers.GetScoreRecords)
+		classPublic.GET("/records", handlers.GetScoreRecords)
+		// 小组排行榜
+		classPublic.GET("/groups", handlers.GetGroupLeaderboard)
+		// 学期及往期存档
+		classPublic.GET("/terms", handlers.GetTerms)
+		classPublic.GET("/terms/:id", handlers.GetTermStandings)
+		// 可兑换的奖励
+		classPublic.GET("/rewards", handlers.GetRewards)
+	}
+
+	// ============ 学生个人中心 ============
+	r.POST("/api/student/login", middleware.StudentLogin(cfg, guard))
+
+	me := r.Group("/api/me")
+	me.Use(middleware.StudentAuth(guard))
+	{
+		me.GET("", handlers.GetMe)
+		me.GET("/records", handlers.GetMyRecords)
+		me.GET("/progress", handlers.GetMyProgress)
+		me.GET("/streaks", handlers.GetMyStreaks)
+		me.POST("/rewards/:id/redeem", handlers.RedeemMyReward)
+		me.GET("/redemptions", handlers.GetMyRedemptions)
+		me.POST("/logout", middleware.Logout)
+	}
+
+	// ============ 家长端 ============
+	r.POST("/api/parent/login", middleware.ParentLogin(cfg, guard))
+	r.POST("/api/parent/register", middleware.ParentRegister(cfg, guard))
+
+	parent := r.Group("/api/parent")
+	parent.Use(middleware.ParentAuth(guard))
+	{
+		parent.GET("/children", handlers.GetChildren)
+		parent.POST("/children", middleware.ParentLinkChild(guard))
+		parent.GET("/children/:id", handlers.GetChild)
+		parent.GET("/children/:id/records", handlers.GetChildRecords)
+		parent.GET("/children/:id/weekly", handlers.GetChildWeekly)
+		parent.GET("/children/:id/redemptions", handlers.GetChildRedemptions)
+		parent.POST("/logout", middleware.Logout)
 	}
 
 	// ============ 管理员登录验证 ============
-	r.POST("/api/admin/login", middleware.CheckAdminPassword(cfg))
-	r.POST("/api/admin/verify-reset", middleware.CheckResetPassword(cfg))
+	r.POST("/api/admin/login", middleware.Login(cfg, guard))
 
 	// ============ 管理员API ============
 	admin := r.Group("/api/admin")
-	admin.Use(middleware.AdminAuth(cfg))
+	admin.Use(middleware.AdminAuth(guard), middleware.Audit())
+	{
+		// 账号与会话
+		admin.POST("/logout", middleware.TeacherOnly(), middleware.Logout)
+		admin.GET("/me", middleware.TeacherOnly(), handlers.GetCurrentTeacher)
+
+		// 教师管理
+		admin.GET("/teachers", middleware.Require(middleware.PermTeachersManage), handlers.GetTeachers)
+		admin.POST("/teachers", middleware.Require(middleware.PermTeachersManage), handlers.CreateTeacher)
+		admin.PUT("/teachers/:id", middleware.Require(middleware.PermTeachersManage), handlers.UpdateTeacher)
+		admin.DELETE("/teachers/:id", middleware.Require(middleware.PermTeachersManage), handlers.DeleteTeacher)
+		admin.POST("/teachers/:id/revoke-sessions", middleware.Require(middleware.PermTeachersManage), handlers.RevokeTeacherSessions)
+
+		// 班级管理
+		admin.GET("/classes", handlers.GetAdminClasses)
+		admin.POST("/classes", middleware.Require(middleware.PermClassesManage), handlers.CreateClass)
+		admin.PUT("/classes/:id", middleware.Require(middleware.PermClassesManage), handlers.UpdateClass)
+		admin.DELETE("/classes/:id", middleware.Require(middleware.PermClassesManage), handlers.DeleteClass)
+
+		// 审计日志
+		admin.GET("/audit", middleware.Require(middleware.PermAuditRead), handlers.GetAuditEntries)
+		admin.GET("/audit/verify", middleware.Require(middleware.PermAuditRead), handlers.VerifyAuditChain)
+
+		// API 密钥
+		admin.GET("/api-keys", middleware.TeacherOnly(), middleware.Require(middleware.PermAPIKeysManage), handlers.GetAPIKeys)
+		admin.POST("/api-keys", middleware.TeacherOnly(), middleware.Require(middleware.PermAPIKeysManage), handlers.CreateAPIKey)
+		admin.DELETE("/api-keys/:id", middleware.TeacherOnly(), middleware.Require(middleware.PermAPIKeysManage), handlers.RevokeAPIKey)
+
+		// 登录锁定
+		admin.GET("/lockouts", middleware.Require(middleware.PermLockoutsManage), guard.ListLockouts)
+		admin.DELETE("/lockouts", middleware.Require(middleware.PermLockoutsManage), guard.ClearLockout)
+	}
+
+	// 以下接口按班级区分，教师只能操作任教的班级
+	classAdmin := admin.Group("")
+	classAdmin.Use(middleware.AdminClass())
 	{
+		// 验证重置密码，签发当前班级危险操作的确认令牌
+		classAdmin.POST("/verify-reset", middleware.TeacherOnly(), middleware.CheckResetPassword(cfg, guard))
+
 		// 学生管理
-		admin.POST("/students", handlers.CreateStudent)
-		admin.PUT("/students/:id", handlers.UpdateStudent)
-		admin.DELETE("/students/:id", handlers.DeleteStudent)
-		admin.POST("/students/batch", handlers.BatchCreateStudents)
+		classAdmin.GET("/students", middleware.Require(middleware.PermStudentsRead), handlers.GetAdminStudents)
+		classAdmin.POST("/students", middleware.Require(middleware.PermStudentsWrite), idempotent, handlers.CreateStudent)
+		classAdmin.PUT("/students/:id", middleware.Require(middleware.PermStudentsWrite), handlers.UpdateStudent)
+		classAdmin.DELETE("/students/:id", middleware.Require(middleware.PermStudentsDelete), handlers.DeleteStudent)
+		classAdmin.POST("/students/batch", middleware.Require(middleware.PermStudentsWrite), idempotent, handlers.BatchCreateStudents)
+		classAdmin.POST("/students/:id/invites", middleware.Require(middleware.PermStudentsWrite), handlers.CreateParentInvite)
+		classAdmin.GET("/students/:id/parents", middleware.Require(middleware.PermStudentsWrite), handlers.GetStudentParents)
+		classAdmin.DELETE("/students/:id/parents/:parent_id", middleware.Require(middleware.PermStudentsWrite), handlers.UnlinkParent)
+		classAdmin.POST("/students/pins", middleware.Require(middleware.PermStudentsWrite), handlers.GenerateStudentPins)
+		classAdmin.POST("/students/batch-delete", middleware.Require(middleware.PermStudentsDelete),
+			middleware.RequireConfirmation(middleware.OpBatchDeleteStudent), handlers.BatchDeleteStudents)
+		classAdmin.PUT("/students/:id/status", middleware.Require(middleware.PermStudentsWrite), handlers.UpdateStudentStatus)
+
+		// 回收站
+		classAdmin.GET("/students/recycle-bin", middleware.Require(middleware.PermStudentsDelete), handlers.GetRecycleBin)
+		classAdmin.POST("/students/:id/restore", middleware.Require(middleware.PermStudentsDelete), handlers.RestoreStudent)
+		classAdmin.DELETE("/students/:id/purge", middleware.Require(middleware.PermStudentsDelete),
+			middleware.RequireConfirmation(middleware.OpPurgeStudent), handlers.PurgeStudent)
+
+		// 小组
+		classAdmin.GET("/groups", middleware.Require(middleware.PermStudentsRead), handlers.GetGroups)
+		classAdmin.POST("/groups", middleware.Require(middleware.PermStudentsWrite), handlers.CreateGroup)
+		classAdmin.PUT("/groups/:id", middleware.Require(middleware.PermStudentsWrite), handlers.UpdateGroup)
+		classAdmin.DELETE("/groups/:id", middleware.Require(middleware.PermStudentsWrite), handlers.DeleteGroup)
+		classAdmin.PUT("/groups/:id/members", middleware.Require(middleware.PermStudentsWrite), handlers.SetGroupMembers)
+		classAdmin.POST("/groups/:id/score", middleware.Require(middleware.PermScoreWrite), handlers.ModifyGroupScore)
+		classAdmin.GET("/groups/:id/records", middleware.Require(middleware.PermStudentsRead), handlers.GetGroupRecords)
 
 		// 积分操作
-		admin.POST("/score", handlers.ModifyScore)
-		admin.POST("/score/batch", handlers.BatchModifyScore)
-		admin.DELETE("/score/:id", handlers.UndoScoreRecord)
+		classAdmin.POST("/score", middleware.Require(middleware.PermScoreWrite), idempotent, handlers.ModifyScore)
+		classAdmin.POST("/score/batch", middleware.Require(middleware.PermScoreWrite), idempotent, handlers.BatchModifyScore)
+		classAdmin.DELETE("/score/:id", middleware.Require(middleware.PermScoreWrite), handlers.UndoScoreRecord)
+		classAdmin.GET("/records", middleware.Require(middleware.PermStudentsRead), handlers.GetScoreLedger)
+		classAdmin.GET("/operations", middleware.Require(middleware.PermScoreWrite), handlers.GetScoreOperations)
+		classAdmin.POST("/operations/:id/undo", middleware.Require(middleware.PermScoreWrite), handlers.UndoScoreOperation)
 
 		// 积分模板
-		admin.POST("/templates", handlers.CreateTemplate)
-		admin.PUT("/templates/:id", handlers.UpdateTemplate)
-		admin.DELETE("/templates/:id", handlers.DeleteTemplate)
+		classAdmin.GET("/templates/stats", middleware.Require(middleware.PermStatsRead), handlers.GetTemplateStats)
+		classAdmin.POST("/templates", middleware.Require(middleware.PermTemplatesWrite), handlers.CreateTemplate)
+		classAdmin.PUT("/templates/:id", middleware.Require(middleware.PermTemplatesWrite), handlers.UpdateTemplate)
+		classAdmin.DELETE("/templates/:id", middleware.Require(middleware.PermTemplatesWrite), handlers.DeleteTemplate)
+
+		// 分类加分上限（模板上限在模板中设置）
+		classAdmin.GET("/category-limits", middleware.Require(middleware.PermStudentsRead), handlers.GetCategoryLimits)
+		classAdmin.PUT("/category-limits", middleware.Require(middleware.PermTemplatesWrite), handlers.SaveCategoryLimit)
+		classAdmin.DELETE("/category-limits/:id", middleware.Require(middleware.PermTemplatesWrite), handlers.DeleteCategoryLimit)
+
+		// 奖励兑换
+		classAdmin.GET("/rewards", middleware.Require(middleware.PermStudentsRead), handlers.GetAdminRewards)
+		classAdmin.POST("/rewards", middleware.Require(middleware.PermRewardsManage), handlers.CreateReward)
+		classAdmin.PUT("/rewards/:id", middleware.Require(middleware.PermRewardsManage), handlers.UpdateReward)
+		classAdmin.DELETE("/rewards/:id", middleware.Require(middleware.PermRewardsManage), handlers.DeleteReward)
+		classAdmin.POST("/rewards/:id/redeem", middleware.Require(middleware.PermRewardsManage), idempotent, handlers.RedeemReward)
+		classAdmin.GET("/redemptions", middleware.Require(middleware.PermStudentsRead), handlers.GetRedemptions)
+		classAdmin.POST("/redemptions/:id/fulfill", middleware.Require(middleware.PermRewardsManage), handlers.FulfillRedemption)
+		classAdmin.POST("/redemptions/:id/cancel", middleware.Require(middleware.PermRewardsManage), handlers.CancelRedemption)
+
+		// 班级隐私设置和展示令牌
+		classAdmin.GET("/settings/privacy", middleware.Require(middleware.PermSettingsManage), handlers.GetPrivacySettings)
+		classAdmin.PUT("/settings/privacy", middleware.Require(middleware.PermSettingsManage), handlers.UpdatePrivacySettings)
+
+		// 班级积分上下限
+		classAdmin.GET("/settings/score-policy", middleware.Require(middleware.PermSettingsManage), handlers.GetScorePolicy)
+		classAdmin.PUT("/settings/score-policy", middleware.Require(middleware.PermSettingsManage), handlers.UpdateScorePolicy)
+
+		// 自动积分规则
+		classAdmin.GET("/rules", middleware.Require(middleware.PermStudentsRead), handlers.GetRules)
+		classAdmin.POST("/rules", middleware.Require(middleware.PermRulesManage), handlers.CreateRule)
+		classAdmin.PUT("/rules/:id", middleware.Require(middleware.PermRulesManage), handlers.UpdateRule)
+		classAdmin.DELETE("/rules/:id", middleware.Require(middleware.PermRulesManage), handlers.DeleteRule)
+		classAdmin.POST("/rules/:id/run", middleware.Require(middleware.PermRulesManage), handlers.RunRule)
+		classAdmin.GET("/rule-runs", middleware.Require(middleware.PermStudentsRead), handlers.GetRuleRuns)
+
+		// 连续记录
+		classAdmin.GET("/streaks", middleware.Require(middleware.PermStudentsRead), handlers.GetStreaks)
+		classAdmin.GET("/streaks/:id/standings", middleware.Require(middleware.PermStatsRead), handlers.GetStreakStandings)
+		classAdmin.POST("/streaks", middleware.Require(middleware.PermRulesManage), handlers.CreateStreak)
+		classAdmin.PUT("/streaks/:id", middleware.Require(middleware.PermRulesManage), handlers.UpdateStreak)
+		classAdmin.DELETE("/streaks/:id", middleware.Require(middleware.PermRulesManage), handlers.DeleteStreak)
 
 		// 段位配置
-		admin.POST("/ranks", handlers.CreateRank)
-		admin.PUT("/ranks/:id", handlers.UpdateRank)
-		admin.DELETE("/ranks/:id", handlers.DeleteRank)
+		classAdmin.POST("/ranks", middleware.Require(middleware.PermRanksWrite), handlers.CreateRank)
+		classAdmin.PUT("/ranks/:id", middleware.Require(middleware.PermRanksWrite), handlers.UpdateRank)
+		classAdmin.DELETE("/ranks/:id", middleware.Require(middleware.PermRanksWrite), handlers.DeleteRank)
+
+		// 学期
+		classAdmin.GET("/terms", middleware.Require(middleware.PermStatsRead), handlers.GetTerms)
+		classAdmin.GET("/terms/:id", middleware.Require(middleware.PermStatsRead), handlers.GetTermStandings)
 
-		// 系统管理
-		admin.POST("/reset", handlers.ResetAllScores)
-		admin.GET("/statistics", handlers.GetStatistics)
+		// 系统管理（重置会结束当前学期并存档）
+		classAdmin.POST("/reset", middleware.Require(middleware.PermSystemReset),
+			middleware.RequireConfirmation(middleware.OpResetScores), handlers.ResetAllScores)
+		classAdmin.GET("/statistics", middleware.Require(middleware.PermStatsRead), handlers.GetStatistics)
 	}
 
 	log.Printf("Server starting on port %s", cfg.ServerPort)
@@ -0,0 +1,83 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"score-backend/database"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	ctxAPIKey = "api_key"
+
+	// API 密钥前缀，便于和会话令牌区分
+	APIKeyPrefix = "sk_"
+)
+
+// 可以授予 API 密钥的权限范围
+var APIKeyScopes = []string{
+	PermStudentsRead, PermStudentsWrite, PermScoreWrite, PermScoreOverride, PermTemplatesWrite,
+	PermRanksWrite, PermStatsRead, PermAuditRead, PermRewardsManage, PermRulesManage,
+}
+
+// 当前请求使用的 API 密钥（教师会话请求时为 nil）
+func CurrentAPIKey(c *gin.Context) *models.APIKey {
+	if v, ok := c.Get(ctxAPIKey); ok {
+		return v.(*models.APIKey)
+	}
+	return nil
+}
+
+// 只允许教师会话访问（账号、密钥管理等不对 API 密钥开放）
+func TeacherOnly() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if CurrentTeacher(c) == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "该接口需要教师登录"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 生成新的 API 密钥，返回明文（只在创建时出现一次）
+func NewAPIKey() (plain, prefix, hash string, err error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", "", "", err
+	}
+	plain = APIKeyPrefix + token
+	return plain, plain[:len(APIKeyPrefix)+8], hashToken(plain), nil
+}
+
+// 从 X-API-Key 或 Authorization: Bearer sk_... 中读取密钥
+func apiKeyFromRequest(c *gin.Context) string {
+	if key := c.GetHeader("X-API-Key"); key != "" {
+		return key
+	}
+	if token := bearerToken(c); strings.HasPrefix(token, APIKeyPrefix) {
+		return token
+	}
+	return ""
+}
+
+func lookupAPIKey(plain string) (*models.APIKey, bool) {
+	var key models.APIKey
+	if err := database.DB.Where("key_hash = ?", hashToken(plain)).First(&key).Error; err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	if !key.Active(now) {
+		return nil, false
+	}
+
+	// 最近使用时间按分钟更新，避免每个请求都写库
+	if key.LastUsedAt == nil || now.Sub(*key.LastUsedAt) > time.Minute {
+		database.DB.Model(&key).Update("last_used_at", now)
+	}
+	return &key, true
+}
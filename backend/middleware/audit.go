@@ -0,0 +1,151 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"score-backend/database"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ctxAuditBefore = "audit_before"
+	ctxAuditAfter  = "audit_after"
+	ctxAuditTarget = "audit_target"
+
+	// 链头哈希保存在 settings 表中，用于发现末尾日志被删除
+	AuditHeadKey = "audit_chain_head"
+)
+
+// 审计日志写入需要串行，保证哈希链顺序
+var auditMu sync.Mutex
+
+// 记录所有管理端写操作（需放在 AdminAuth 之后）
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet {
+			c.Next()
+			return
+		}
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		c.Next()
+
+		entry := models.AuditEntry{
+			Method:   c.Request.Method,
+			Route:    c.FullPath(),
+			TargetID: c.Param("id"),
+			Status:   c.Writer.Status(),
+			ClientIP: c.ClientIP(),
+		}
+		entry.TeacherID, entry.Actor = CurrentActor(c)
+		if v, ok := c.Get(ctxAuditTarget); ok {
+			entry.TargetID = v.(string)
+		}
+		if v, ok := c.Get(ctxAuditBefore); ok {
+			entry.Before = toJSON(v)
+		}
+		if v, ok := c.Get(ctxAuditAfter); ok {
+			entry.After = toJSON(v)
+		} else {
+			entry.After = sanitizeBody(body)
+		}
+
+		if err := WriteAudit(&entry); err != nil {
+			log.Println("Failed to write audit entry:", err)
+		}
+	}
+}
+
+// 当前操作者：教师为用户名，API 密钥为 "apikey:<前缀>"（教师 ID 取创建者）
+func CurrentActor(c *gin.Context) (teacherID uint, actor string) {
+	if teacher := CurrentTeacher(c); teacher != nil {
+		return teacher.ID, teacher.Username
+	}
+	if key := CurrentAPIKey(c); key != nil {
+		return key.CreatedBy, "apikey:" + key.Prefix
+	}
+	return 0, ""
+}
+
+// 记录修改前的数据
+func AuditBefore(c *gin.Context, v interface{}) {
+	c.Set(ctxAuditBefore, v)
+}
+
+// 记录修改后的数据（不设置时使用请求体）
+func AuditAfter(c *gin.Context, v interface{}) {
+	c.Set(ctxAuditAfter, v)
+}
+
+// 指定操作对象（不设置时使用路由中的 :id）
+func AuditTarget(c *gin.Context, id string) {
+	c.Set(ctxAuditTarget, id)
+}
+
+// 追加一条审计日志，并把它链接到上一条
+func WriteAudit(entry *models.AuditEntry) error {
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		var head models.Setting
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("`key` = ?", AuditHeadKey).First(&head).Error
+		if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+			return err
+		}
+
+		// 截断到毫秒，与数据库 datetime(3) 精度一致，保证可复算
+		entry.CreatedAt = time.Now().Truncate(time.Millisecond)
+		entry.PrevHash = head.Value
+		entry.Hash = entry.ComputeHash()
+		if err := tx.Create(entry).Error; err != nil {
+			return err
+		}
+
+		head.Key = AuditHeadKey
+		head.Value = entry.Hash
+		return tx.Save(&head).Error
+	})
+}
+
+func toJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// 请求体中的密码类字段不落日志
+func sanitizeBody(body []byte) string {
+	if len(body) == 0 {
+		return ""
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return ""
+	}
+	for _, key := range []string{"password", "pin", "new_password"} {
+		if _, ok := fields[key]; ok {
+			fields[key] = "***"
+		}
+	}
+	return toJSON(fields)
+}
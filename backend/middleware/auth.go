@@ -1,61 +1,195 @@
 package middleware
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
 	"net/http"
+	"strings"
+	"time"
 
 	"score-backend/config"
+	"score-backend/database"
+	"score-backend/models"
 
 	"github.com/gin-gonic/gin"
 )
 
-func AdminAuth(cfg *config.Config) gin.HandlerFunc {
+const (
+	ctxTeacher = "teacher"
+	ctxSession = "session"
+)
+
+// 管理员鉴权：解析教师会话令牌或 API 密钥并写入上下文
+// 同一 IP 频繁使用无效令牌会被临时锁定，有效的会话和密钥不受锁定影响
+func AdminAuth(guard *LoginGuard) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		password := c.GetHeader("X-Admin-Password")
-		if password != cfg.AdminPassword {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "管理员密码错误"})
+		if plain := apiKeyFromRequest(c); plain != "" {
+			key, ok := lookupAPIKey(plain)
+			if !ok {
+				failAuth(c, guard, "API 密钥无效或已过期")
+				return
+			}
+			c.Set(ctxAPIKey, key)
+			c.Next()
+			return
+		}
+
+		session, ok := lookupSession(c, models.SessionKindTeacher)
+		if !ok {
+			failAuth(c, guard, "登录已失效，请重新登录")
+			return
+		}
+
+		var teacher models.Teacher
+		if err := database.DB.First(&teacher, session.SubjectID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "账号不存在"})
 			c.Abort()
 			return
 		}
+
+		c.Set(ctxSession, session)
+		c.Set(ctxTeacher, &teacher)
 		c.Next()
 	}
 }
 
-// 验证管理员密码（用于登录）
-func CheckAdminPassword(cfg *config.Config) gin.HandlerFunc {
+// 无效令牌：IP 已锁定时返回锁定信息，否则记一次失败
+func failAuth(c *gin.Context, guard *LoginGuard, msg string) {
+	if status := guard.Check(ipKey(c)); status.Locked {
+		abortLocked(c, status)
+		return
+	}
+	status := guard.Fail(ipKey(c))
+	c.JSON(http.StatusUnauthorized, gin.H{"error": msg, "lockout": status})
+	c.Abort()
+}
+
+// 当前登录的教师（仅在 AdminAuth 之后可用）
+func CurrentTeacher(c *gin.Context) *models.Teacher {
+	if v, ok := c.Get(ctxTeacher); ok {
+		return v.(*models.Teacher)
+	}
+	return nil
+}
+
+// 当前会话
+func CurrentSession(c *gin.Context) *models.Session {
+	if v, ok := c.Get(ctxSession); ok {
+		return v.(*models.Session)
+	}
+	return nil
+}
+
+// 教师登录，签发会话令牌（按 IP 和账号分别限制失败次数）
+func Login(cfg *config.Config, guard *LoginGuard) gin.HandlerFunc {
 	return func(c *gin.Context) {
 		var input struct {
+			Username string `json:"username" binding:"required"`
 			Password string `json:"password" binding:"required"`
 		}
 		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入密码"})
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入用户名和密码"})
 			return
 		}
 
-		if input.Password != cfg.AdminPassword {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "密码错误"})
+		keys := []string{ipKey(c), "account:" + input.Username}
+		if status := guard.Check(keys...); status.Locked {
+			abortLocked(c, status)
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "登录成功"})
-	}
-}
-
-// 验证重置密码
-func CheckResetPassword(cfg *config.Config) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		var input struct {
-			Password string `json:"password" binding:"required"`
-		}
-		if err := c.ShouldBindJSON(&input); err != nil {
-			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入重置密码"})
+		var teacher models.Teacher
+		if err := database.DB.Where("username = ?", input.Username).First(&teacher).Error; err != nil || !teacher.CheckPassword(input.Password) {
+			status := guard.Fail(keys...)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误", "lockout": status})
 			return
 		}
+		guard.Succeed(keys...)
 
-		if input.Password != cfg.ResetPassword {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "重置密码错误"})
+		token, session, err := NewSession(models.SessionKindTeacher, teacher.ID, c.ClientIP(), cfg.SessionTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{"message": "验证成功"})
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "登录成功",
+			"token":      token,
+			"expires_at": session.ExpiresAt,
+			"teacher":    teacher,
+		})
 	}
 }
+
+// 退出登录，吊销当前会话
+func Logout(c *gin.Context) {
+	if session := CurrentSession(c); session != nil {
+		database.DB.Model(session).Update("revoked_at", time.Now())
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "已退出登录"})
+}
+
+// 创建会话，返回明文令牌（数据库只保存哈希）
+func NewSession(kind string, subjectID uint, clientIP string, ttl time.Duration) (string, *models.Session, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", nil, err
+	}
+
+	session := models.Session{
+		TokenHash: hashToken(token),
+		Kind:      kind,
+		SubjectID: subjectID,
+		ClientIP:  clientIP,
+		ExpiresAt: time.Now().Add(ttl),
+	}
+	if err := database.DB.Create(&session).Error; err != nil {
+		return "", nil, err
+	}
+	return token, &session, nil
+}
+
+// 吊销某个账号的全部会话
+func RevokeSessions(kind string, subjectID uint) error {
+	return database.DB.Model(&models.Session{}).
+		Where("kind = ? AND subject_id = ? AND revoked_at IS NULL", kind, subjectID).
+		Update("revoked_at", time.Now()).Error
+}
+
+func lookupSession(c *gin.Context, kind string) (*models.Session, bool) {
+	token := bearerToken(c)
+	if token == "" {
+		return nil, false
+	}
+
+	var session models.Session
+	if err := database.DB.Where("token_hash = ? AND kind = ?", hashToken(token), kind).First(&session).Error; err != nil {
+		return nil, false
+	}
+	if !session.Active(time.Now()) {
+		return nil, false
+	}
+	return &session, true
+}
+
+func bearerToken(c *gin.Context) string {
+	header := c.GetHeader("Authorization")
+	if !strings.HasPrefix(header, "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
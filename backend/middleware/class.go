@@ -0,0 +1,108 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+
+	"score-backend/database"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const ctxClass = "class"
+
+// 公开接口按班级区分：读取 X-Class-ID 或 class_id 参数，未指定时使用第一个班级
+func PublicClass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := database.DB.Order("id ASC")
+		if id := requestedClassID(c); id != 0 {
+			query = query.Where("id = ?", id)
+		}
+
+		var class models.Class
+		if err := query.First(&class).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "班级不存在"})
+			c.Abort()
+			return
+		}
+
+		c.Set(ctxClass, &class)
+		c.Next()
+	}
+}
+
+// 管理端按班级区分：教师只能操作自己任教的班级，管理员可操作全部班级
+// API 密钥沿用创建者的班级范围（需放在 AdminAuth 之后）
+func AdminClass() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := AccessibleClasses(c)
+		if id := requestedClassID(c); id != 0 {
+			query = query.Where("classes.id = ?", id)
+		}
+
+		var class models.Class
+		if err := query.First(&class).Error; err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "没有该班级的管理权限"})
+			c.Abort()
+			return
+		}
+
+		c.Set(ctxClass, &class)
+		c.Next()
+	}
+}
+
+// 当前教师（或 API 密钥的创建者）可管理的班级查询
+func AccessibleClasses(c *gin.Context) *gorm.DB {
+	teacher := CurrentTeacher(c)
+	if teacher == nil {
+		if key := CurrentAPIKey(c); key != nil {
+			var creator models.Teacher
+			if database.DB.First(&creator, key.CreatedBy).Error == nil {
+				teacher = &creator
+			}
+		}
+	}
+
+	return classesOf(teacher)
+}
+
+// 教师可管理的班级查询，teacher 为空时不返回任何班级
+func classesOf(teacher *models.Teacher) *gorm.DB {
+	query := database.DB.Model(&models.Class{}).Order("classes.id ASC")
+	if teacher == nil {
+		return query.Where("1 = 0")
+	}
+	if teacher.Role != models.RoleOwner {
+		query = query.Joins("JOIN teacher_classes ON teacher_classes.class_id = classes.id").
+			Where("teacher_classes.teacher_id = ?", teacher.ID)
+	}
+	return query
+}
+
+// 当前请求所属的班级（仅在 PublicClass / AdminClass 之后可用）
+func CurrentClass(c *gin.Context) *models.Class {
+	if v, ok := c.Get(ctxClass); ok {
+		return v.(*models.Class)
+	}
+	return nil
+}
+
+// 当前班级 ID，未确定班级时为 0
+func CurrentClassID(c *gin.Context) uint {
+	if class := CurrentClass(c); class != nil {
+		return class.ID
+	}
+	return 0
+}
+
+func requestedClassID(c *gin.Context) uint {
+	raw := c.GetHeader("X-Class-ID")
+	if raw == "" {
+		raw = c.Query("class_id")
+	}
+	id, _ := strconv.ParseUint(raw, 10, 64)
+	return uint(id)
+}
@@ -0,0 +1,131 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"score-backend/config"
+	"score-backend/database"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 需要重置密码二次确认的操作
+const (
+	OpResetScores        = "reset"
+	OpBatchDeleteStudent = "students:batch-delete"
+	OpPurgeStudent       = "students:purge"
+)
+
+var confirmOperations = map[string]bool{
+	OpResetScores:        true,
+	OpBatchDeleteStudent: true,
+	OpPurgeStudent:       true,
+}
+
+// 针对单个对象、令牌需要绑定对象 ID 的操作
+var confirmTargetOperations = map[string]bool{
+	OpPurgeStudent: true,
+}
+
+// 验证重置密码，签发绑定到指定操作、当前班级（和操作对象）的一次性确认令牌
+// 需放在 AdminClass 之后
+func CheckResetPassword(cfg *config.Config, guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Password  string `json:"password" binding:"required"`
+			Operation string `json:"operation" binding:"required"`
+			TargetID  uint   `json:"target_id"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入重置密码"})
+			return
+		}
+		if !confirmOperations[input.Operation] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "不支持的操作"})
+			return
+		}
+		if confirmTargetOperations[input.Operation] && input.TargetID == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请指定操作对象"})
+			return
+		}
+		if !confirmTargetOperations[input.Operation] {
+			input.TargetID = 0
+		}
+
+		keys := []string{ipKey(c), "reset:" + CurrentTeacher(c).Username}
+		if status := guard.Check(keys...); status.Locked {
+			abortLocked(c, status)
+			return
+		}
+		if input.Password != cfg.ResetPassword {
+			status := guard.Fail(keys...)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "重置密码错误", "lockout": status})
+			return
+		}
+		guard.Succeed(keys...)
+
+		token, err := randomToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+			return
+		}
+		confirm := models.ConfirmToken{
+			TokenHash: hashToken(token),
+			Operation: input.Operation,
+			TeacherID: CurrentTeacher(c).ID,
+			ClassID:   CurrentClassID(c),
+			TargetID:  input.TargetID,
+			ExpiresAt: time.Now().Add(cfg.ConfirmTTL),
+		}
+		if err := database.DB.Create(&confirm).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "验证失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":       "验证成功",
+			"confirm_token": token,
+			"operation":     confirm.Operation,
+			"class_id":      confirm.ClassID,
+			"target_id":     confirm.TargetID,
+			"expires_at":    confirm.ExpiresAt,
+		})
+	}
+}
+
+// 要求请求携带该操作的确认令牌（X-Confirm-Token），令牌使用后立即作废
+// 令牌必须是在当前班级签发的；针对单个对象的操作还要求路由中的 :id 与令牌一致
+func RequireConfirmation(operation string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var targetID uint
+		if confirmTargetOperations[operation] {
+			id, _ := strconv.ParseUint(c.Param("id"), 10, 64)
+			targetID = uint(id)
+		}
+
+		token := c.GetHeader("X-Confirm-Token")
+		teacher := CurrentTeacher(c)
+		if token == "" || teacher == nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "该操作需要先验证重置密码"})
+			c.Abort()
+			return
+		}
+
+		// 条件更新保证并发下只有一个请求能用掉令牌
+		now := time.Now()
+		result := database.DB.Model(&models.ConfirmToken{}).
+			Where("token_hash = ? AND operation = ? AND teacher_id = ? AND class_id = ? AND target_id = ? AND used_at IS NULL AND expires_at > ?",
+				hashToken(token), operation, teacher.ID, CurrentClassID(c), targetID, now).
+			Update("used_at", now)
+		if result.Error != nil || result.RowsAffected != 1 {
+			c.JSON(http.StatusForbidden, gin.H{"error": "确认令牌无效或已过期，请重新验证"})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
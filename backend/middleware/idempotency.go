@@ -0,0 +1,100 @@
+package middleware
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"time"
+
+	"score-backend/config"
+	"score-backend/database"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 幂等写请求：请求带 Idempotency-Key 时保存第一次的响应，网络重试或重复点击直接返回保存的响应
+// 键按操作者区分；同一个键用于不同请求返回 422，第一次请求尚未完成时返回 409
+func Idempotent(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader("Idempotency-Key")
+		if key == "" {
+			c.Next()
+			return
+		}
+		if len(key) > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key 不能超过 100 个字符"})
+			c.Abort()
+			return
+		}
+		_, actor := CurrentActor(c)
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+		requestHash := hashToken(c.Request.Method + " " + c.Request.URL.RequestURI() + " " + c.GetHeader("X-Class-ID") + "\n" + string(body))
+
+		now := time.Now()
+		// 过期的键可以重新使用
+		database.DB.Where("actor = ? AND `key` = ? AND expires_at <= ?", actor, key, now).Delete(&models.IdempotencyKey{})
+
+		record := models.IdempotencyKey{Actor: actor, Key: key, RequestHash: requestHash, ExpiresAt: now.Add(cfg.IdempotencyTTL)}
+		// 唯一索引保证并发的重复请求只有一个能继续执行
+		if err := database.DB.Create(&record).Error; err != nil {
+			var existing models.IdempotencyKey
+			if database.DB.Where("actor = ? AND `key` = ?", actor, key).First(&existing).Error != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "处理 Idempotency-Key 失败"})
+				c.Abort()
+				return
+			}
+			switch {
+			case existing.RequestHash != requestHash:
+				c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "该 Idempotency-Key 已用于其他请求"})
+			case existing.Status == 0:
+				c.JSON(http.StatusConflict, gin.H{"error": "相同的请求正在处理中，请稍后重试"})
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(existing.Status, "application/json; charset=utf-8", []byte(existing.Response))
+			}
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		// handler panic 时删除键再继续向上抛，客户端可以用同一个键重试
+		defer func() {
+			if err := recover(); err != nil {
+				database.DB.Delete(&record)
+				panic(err)
+			}
+		}()
+		c.Next()
+
+		// 服务端错误不保存，客户端可以用同一个键重试
+		status := recorder.Status()
+		if status >= http.StatusInternalServerError {
+			database.DB.Delete(&record)
+			return
+		}
+		database.DB.Model(&record).Updates(map[string]interface{}{"status": status, "response": recorder.body.String()})
+	}
+}
+
+// 在写出响应的同时保存一份响应体
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *responseRecorder) Write(data []byte) (int, error) {
+	w.body.Write(data)
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *responseRecorder) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
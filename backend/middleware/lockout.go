@@ -0,0 +1,228 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"score-backend/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 某个键（IP 或账号）的失败记录
+type AttemptState struct {
+	Key         string    `json:"key"`
+	Failures    int       `json:"failures"`
+	LastFailure time.Time `json:"last_failure"`
+	LockedUntil time.Time `json:"locked_until"`
+}
+
+// 失败次数存储，默认使用内存实现
+type AttemptStore interface {
+	Get(key string) (AttemptState, bool)
+	Set(state AttemptState)
+	Delete(key string)
+	All() []AttemptState
+}
+
+// 内存存储（单实例部署足够，重启后清空）
+type MemoryAttemptStore struct {
+	mu     sync.Mutex
+	states map[string]AttemptState
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{states: make(map[string]AttemptState)}
+}
+
+func (s *MemoryAttemptStore) Get(key string) (AttemptState, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, ok := s.states[key]
+	return state, ok
+}
+
+func (s *MemoryAttemptStore) Set(state AttemptState) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.states[state.Key] = state
+}
+
+func (s *MemoryAttemptStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.states, key)
+}
+
+func (s *MemoryAttemptStore) All() []AttemptState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]AttemptState, 0, len(s.states))
+	for _, state := range s.states {
+		list = append(list, state)
+	}
+	return list
+}
+
+// 登录防爆破：超过次数后按指数退避锁定
+type LoginGuard struct {
+	store       AttemptStore
+	maxAttempts int
+	baseLock    time.Duration
+	maxLock     time.Duration
+
+	sweepMu   sync.Mutex
+	lastSweep time.Time
+}
+
+func NewLoginGuard(cfg *config.Config, store AttemptStore) *LoginGuard {
+	return &LoginGuard{
+		store:       store,
+		maxAttempts: cfg.LockoutMaxAttempts,
+		baseLock:    cfg.LockoutBase,
+		maxLock:     cfg.LockoutMax,
+	}
+}
+
+// 锁定状态，随错误响应一起返回
+type LockStatus struct {
+	Locked            bool       `json:"locked"`
+	LockedUntil       *time.Time `json:"locked_until,omitempty"`
+	RetryAfter        int        `json:"retry_after,omitempty"`
+	RemainingAttempts int        `json:"remaining_attempts"`
+}
+
+// 检查这些键中是否有处于锁定期的
+func (g *LoginGuard) Check(keys ...string) LockStatus {
+	now := time.Now()
+	status := LockStatus{RemainingAttempts: g.maxAttempts}
+	for _, key := range keys {
+		state, ok := g.current(key, now)
+		if !ok {
+			continue
+		}
+		if state.LockedUntil.After(now) && (status.LockedUntil == nil || state.LockedUntil.After(*status.LockedUntil)) {
+			lockedUntil := state.LockedUntil
+			status.Locked = true
+			status.LockedUntil = &lockedUntil
+			status.RetryAfter = int(math.Ceil(state.LockedUntil.Sub(now).Seconds()))
+		}
+		if remaining := g.maxAttempts - state.Failures; remaining < status.RemainingAttempts {
+			status.RemainingAttempts = remaining
+		}
+	}
+	if status.RemainingAttempts < 0 {
+		status.RemainingAttempts = 0
+	}
+	return status
+}
+
+// 记录一次失败，达到阈值后锁定，之后每次失败锁定时间翻倍
+func (g *LoginGuard) Fail(keys ...string) LockStatus {
+	now := time.Now()
+	g.sweep(now)
+	for _, key := range keys {
+		state, _ := g.current(key, now)
+		state.Key = key
+		state.Failures++
+		state.LastFailure = now
+		if over := state.Failures - g.maxAttempts; over >= 0 {
+			lock := g.maxLock
+			if over < 32 {
+				lock = g.baseLock << uint(over)
+			}
+			if lock <= 0 || lock > g.maxLock {
+				lock = g.maxLock
+			}
+			state.LockedUntil = now.Add(lock)
+		}
+		g.store.Set(state)
+	}
+	return g.Check(keys...)
+}
+
+// 成功后清除失败记录
+func (g *LoginGuard) Succeed(keys ...string) {
+	for _, key := range keys {
+		g.store.Delete(key)
+	}
+}
+
+// 读取键的状态；超过最长锁定时间没有新的失败则视为已过期
+func (g *LoginGuard) current(key string, now time.Time) (AttemptState, bool) {
+	state, ok := g.store.Get(key)
+	if !ok {
+		return AttemptState{}, false
+	}
+	if now.Sub(state.LastFailure) > g.maxLock && !state.LockedUntil.After(now) {
+		g.store.Delete(key)
+		return AttemptState{}, false
+	}
+	return state, true
+}
+
+// 清理已过期的记录，避免不再出现的 IP 和账号一直占用内存；最多每分钟一次
+func (g *LoginGuard) sweep(now time.Time) {
+	g.sweepMu.Lock()
+	if now.Sub(g.lastSweep) < time.Minute {
+		g.sweepMu.Unlock()
+		return
+	}
+	g.lastSweep = now
+	g.sweepMu.Unlock()
+
+	for _, state := range g.store.All() {
+		g.current(state.Key, now)
+	}
+}
+
+// 返回 429 和锁定状态
+func abortLocked(c *gin.Context, status LockStatus) {
+	c.Header("Retry-After", strconv.Itoa(status.RetryAfter))
+	c.JSON(http.StatusTooManyRequests, gin.H{"error": "尝试次数过多，请稍后再试", "lockout": status})
+	c.Abort()
+}
+
+// 查看当前的失败记录与锁定
+func (g *LoginGuard) ListLockouts(c *gin.Context) {
+	now := time.Now()
+	var list []AttemptState
+	for _, state := range g.store.All() {
+		if state, ok := g.current(state.Key, now); ok {
+			list = append(list, state)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].LastFailure.After(list[j].LastFailure) })
+	c.JSON(http.StatusOK, gin.H{"data": list})
+}
+
+// 解除锁定，未指定 key 时清除全部
+func (g *LoginGuard) ClearLockout(c *gin.Context) {
+	key := c.Query("key")
+	if key == "" {
+		for _, state := range g.store.All() {
+			g.store.Delete(state.Key)
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "已清除全部锁定"})
+		return
+	}
+	g.store.Delete(key)
+	c.JSON(http.StatusOK, gin.H{"message": "已解除锁定"})
+}
+
+// 按入口分别计数的 IP 键：学生和家长与教师常在同一出口 IP 下，互不影响锁定
+func ipKey(c *gin.Context) string {
+	return "ip:" + c.ClientIP()
+}
+
+func studentIPKey(c *gin.Context) string {
+	return "student-ip:" + c.ClientIP()
+}
+
+func parentIPKey(c *gin.Context) string {
+	return "parent-ip:" + c.ClientIP()
+}
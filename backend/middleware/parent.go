@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"score-backend/config"
+	"score-backend/database"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const ctxParent = "parent"
+
+var ErrInviteInvalid = errors.New("邀请码无效或已过期")
+
+// 家长鉴权
+func ParentAuth(guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 有效会话不受 IP 锁定影响，只有无效令牌才计数
+		session, ok := lookupSession(c, models.SessionKindParent)
+		if !ok {
+			if status := guard.Check(parentIPKey(c)); status.Locked {
+				abortLocked(c, status)
+				return
+			}
+			status := guard.Fail(parentIPKey(c))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录", "lockout": status})
+			c.Abort()
+			return
+		}
+
+		var parent models.Parent
+		if err := database.DB.First(&parent, session.SubjectID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "账号不存在"})
+			c.Abort()
+			return
+		}
+
+		c.Set(ctxSession, session)
+		c.Set(ctxParent, &parent)
+		c.Next()
+	}
+}
+
+// 当前登录的家长（仅在 ParentAuth 之后可用）
+func CurrentParent(c *gin.Context) *models.Parent {
+	if v, ok := c.Get(ctxParent); ok {
+		return v.(*models.Parent)
+	}
+	return nil
+}
+
+// 家长登录
+func ParentLogin(cfg *config.Config, guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Username string `json:"username" binding:"required"`
+			Password string `json:"password" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入用户名和密码"})
+			return
+		}
+
+		keys := []string{parentIPKey(c), "parent:" + input.Username}
+		if status := guard.Check(keys...); status.Locked {
+			abortLocked(c, status)
+			return
+		}
+
+		var parent models.Parent
+		if err := database.DB.Where("username = ?", input.Username).First(&parent).Error; err != nil || !parent.CheckPassword(input.Password) {
+			status := guard.Fail(keys...)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "用户名或密码错误", "lockout": status})
+			return
+		}
+		guard.Succeed(keys...)
+
+		respondParentSession(c, cfg, &parent)
+	}
+}
+
+// 家长使用邀请码注册，注册后自动绑定对应学生
+func ParentRegister(cfg *config.Config, guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code     string `json:"code" binding:"required"`
+			Username string `json:"username" binding:"required"`
+			Name     string `json:"name"`
+			Password string `json:"password" binding:"required,min=6"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		// 邀请码同样按 IP 限制猜测次数
+		if status := guard.Check(parentIPKey(c)); status.Locked {
+			abortLocked(c, status)
+			return
+		}
+
+		parent := models.Parent{Username: input.Username, Name: input.Name}
+		if err := parent.SetPassword(input.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败"})
+			return
+		}
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(&parent).Error; err != nil {
+				return err
+			}
+			return RedeemInvite(tx, input.Code, &parent)
+		})
+		if errors.Is(err, ErrInviteInvalid) {
+			status := guard.Fail(parentIPKey(c))
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "lockout": status})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "注册失败，用户名可能已存在"})
+			return
+		}
+
+		respondParentSession(c, cfg, &parent)
+	}
+}
+
+// 已登录的家长用新的邀请码绑定另一个孩子
+func ParentLinkChild(guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入邀请码"})
+			return
+		}
+
+		keys := []string{parentIPKey(c), "parent:" + CurrentParent(c).Username}
+		if status := guard.Check(keys...); status.Locked {
+			abortLocked(c, status)
+			return
+		}
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			return RedeemInvite(tx, input.Code, CurrentParent(c))
+		})
+		if errors.Is(err, ErrInviteInvalid) {
+			status := guard.Fail(keys...)
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error(), "lockout": status})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "绑定失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "绑定成功"})
+	}
+}
+
+// 使用邀请码把学生绑定到家长账号，邀请码只能使用一次
+func RedeemInvite(tx *gorm.DB, code string, parent *models.Parent) error {
+	now := time.Now()
+	var invite models.ParentInvite
+	if err := tx.Where("code = ?", code).First(&invite).Error; err != nil {
+		return ErrInviteInvalid
+	}
+
+	result := tx.Model(&models.ParentInvite{}).
+		Where("id = ? AND used_at IS NULL AND expires_at > ?", invite.ID, now).
+		Updates(map[string]interface{}{"used_at": now, "parent_id": parent.ID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected != 1 {
+		return ErrInviteInvalid
+	}
+
+	var student models.Student
+	if err := tx.Where("status <> ?", models.StudentDeleted).First(&student, invite.StudentID).Error; err != nil {
+		return ErrInviteInvalid
+	}
+	return tx.Model(parent).Association("Students").Append(&student)
+}
+
+func respondParentSession(c *gin.Context, cfg *config.Config, parent *models.Parent) {
+	token, session, err := NewSession(models.SessionKindParent, parent.ID, c.ClientIP(), cfg.SessionTTL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":    "登录成功",
+		"token":      token,
+		"expires_at": session.ExpiresAt,
+		"parent":     parent,
+	})
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"net/http"
+
+	"score-backend/database"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+// 权限点
+const (
+	PermStudentsRead   = "students:read"
+	PermStudentsWrite  = "students:write"
+	PermStudentsDelete = "students:delete"
+	PermScoreWrite     = "score:write"
+	PermScoreOverride  = "score:override" // 忽略加分上限
+	PermTemplatesWrite = "templates:write"
+	PermRanksWrite     = "ranks:write"
+	PermStatsRead      = "statistics:read"
+	PermSystemReset    = "system:reset"
+	PermTeachersManage = "teachers:manage"
+	PermAuditRead      = "audit:read"
+	PermLockoutsManage = "lockouts:manage"
+	PermSettingsManage = "settings:manage"
+	PermAPIKeysManage  = "apikeys:manage"
+	PermClassesManage  = "classes:manage"
+	PermRewardsManage  = "rewards:manage"
+	PermRulesManage    = "rules:manage" // 自动积分规则
+)
+
+// 各角色拥有的权限
+var rolePermissions = map[string][]string{
+	models.RoleOwner: {
+		PermStudentsRead, PermStudentsWrite, PermStudentsDelete, PermScoreWrite, PermScoreOverride, PermTemplatesWrite,
+		PermRanksWrite, PermStatsRead, PermSystemReset, PermTeachersManage, PermAuditRead,
+		PermLockoutsManage, PermSettingsManage, PermAPIKeysManage, PermClassesManage, PermRewardsManage,
+		PermRulesManage,
+	},
+	models.RoleHomeroom: {
+		PermStudentsRead, PermStudentsWrite, PermScoreWrite, PermScoreOverride, PermTemplatesWrite, PermRanksWrite, PermStatsRead,
+		PermRewardsManage, PermRulesManage,
+	},
+	models.RoleSubject: {
+		PermStudentsRead, PermScoreWrite, PermStatsRead,
+	},
+	models.RoleObserver: {
+		PermStudentsRead, PermStatsRead,
+	},
+}
+
+// 角色拥有的全部权限
+func RolePermissions(role string) []string {
+	return rolePermissions[role]
+}
+
+// 角色是否拥有某权限
+func RoleHas(role, perm string) bool {
+	for _, p := range rolePermissions[role] {
+		if p == perm {
+			return true
+		}
+	}
+	return false
+}
+
+// 要求当前教师（或 API 密钥）拥有指定权限
+func Require(perm string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !allowed(c, perm) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "没有权限执行此操作"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// 当前教师（或 API 密钥）是否拥有指定权限
+func Can(c *gin.Context, perm string) bool {
+	return allowed(c, perm)
+}
+
+// 教师按角色判断，API 密钥按授予的范围判断
+func allowed(c *gin.Context, perm string) bool {
+	if key := CurrentAPIKey(c); key != nil {
+		return key.HasScope(perm)
+	}
+	teacher := CurrentTeacher(c)
+	return teacher != nil && RoleHas(teacher.Role, perm)
+}
+
+// 当前教师能否操作某个分类的积分
+// 科任老师只能操作自己负责的分类，其余有积分权限的角色不限分类
+func CanScoreCategory(c *gin.Context, category string) bool {
+	if key := CurrentAPIKey(c); key != nil {
+		return key.HasScope(PermScoreWrite)
+	}
+	teacher := CurrentTeacher(c)
+	if teacher == nil || !RoleHas(teacher.Role, PermScoreWrite) {
+		return false
+	}
+	if teacher.Role != models.RoleSubject {
+		return true
+	}
+	for _, allowed := range teacher.CategoryList() {
+		if allowed == category {
+			return true
+		}
+	}
+	return false
+}
+
+// 当前教师能否给某个小组（或该小组的学生）加减分
+// 科任老师分配了负责小组时只能操作这些小组，未分配时不限
+func CanScoreGroup(c *gin.Context, groupID uint) bool {
+	teacher := CurrentTeacher(c)
+	if teacher == nil || teacher.Role != models.RoleSubject {
+		return true
+	}
+	var groupIDs []uint
+	database.DB.Table("teacher_groups").Where("teacher_id = ?", teacher.ID).Pluck("group_id", &groupIDs)
+	if len(groupIDs) == 0 {
+		return true
+	}
+	for _, id := range groupIDs {
+		if id == groupID {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package middleware
+
+import (
+	"crypto/subtle"
+	"net/http"
+
+	"score-backend/database"
+	"score-backend/models"
+	"score-backend/settings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ctxPrivacy = "privacy"
+
+// 公开接口的隐私控制：按当前班级的策略校验该班级的展示令牌，并把策略交给后续 handler
+// 已登录的教师查看自己可管理的班级时不受限制（需放在 PublicClass 之后）
+func PublicAccess() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if teacherCanView(c) {
+			c.Set(ctxPrivacy, settings.PrivacyPolicy{})
+			c.Next()
+			return
+		}
+
+		policy, err := settings.LoadPrivacy(CurrentClassID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "读取隐私设置失败"})
+			c.Abort()
+			return
+		}
+
+		if policy.RequireDisplayToken {
+			token := c.GetHeader("X-Display-Token")
+			if token == "" {
+				token = c.Query("display_token")
+			}
+			if policy.DisplayToken == "" || subtle.ConstantTimeCompare([]byte(token), []byte(policy.DisplayToken)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "需要班级展示令牌"})
+				c.Abort()
+				return
+			}
+		}
+
+		c.Set(ctxPrivacy, policy)
+		c.Next()
+	}
+}
+
+// 请求带有教师会话，且该教师可以管理当前班级
+func teacherCanView(c *gin.Context) bool {
+	session, ok := lookupSession(c, models.SessionKindTeacher)
+	if !ok {
+		return false
+	}
+	var teacher models.Teacher
+	if database.DB.First(&teacher, session.SubjectID).Error != nil {
+		return false
+	}
+	var count int64
+	classesOf(&teacher).Where("classes.id = ?", CurrentClassID(c)).Count(&count)
+	return count > 0
+}
+
+// 当前请求适用的隐私策略（未经过 PublicAccess 时不做限制）
+func CurrentPrivacy(c *gin.Context) settings.PrivacyPolicy {
+	if v, ok := c.Get(ctxPrivacy); ok {
+		return v.(settings.PrivacyPolicy)
+	}
+	return settings.PrivacyPolicy{}
+}
@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+
+	"score-backend/config"
+	"score-backend/database"
+	"score-backend/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const ctxStudent = "student"
+
+// 学生鉴权：只能访问自己的数据
+func StudentAuth(guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// 有效会话不受 IP 锁定影响，只有无效令牌才计数
+		session, ok := lookupSession(c, models.SessionKindStudent)
+		if !ok {
+			if status := guard.Check(studentIPKey(c)); status.Locked {
+				abortLocked(c, status)
+				return
+			}
+			status := guard.Fail(studentIPKey(c))
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "登录已失效，请重新登录", "lockout": status})
+			c.Abort()
+			return
+		}
+
+		var student models.Student
+		if err := database.DB.Where("status = ?", models.StudentActive).First(&student, session.SubjectID).Error; err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "学生不存在"})
+			c.Abort()
+			return
+		}
+
+		c.Set(ctxSession, session)
+		c.Set(ctxStudent, &student)
+		c.Next()
+	}
+}
+
+// 当前登录的学生（仅在 StudentAuth 之后可用）
+func CurrentStudent(c *gin.Context) *models.Student {
+	if v, ok := c.Get(ctxStudent); ok {
+		return v.(*models.Student)
+	}
+	return nil
+}
+
+// 学生使用学号和 PIN 登录
+func StudentLogin(cfg *config.Config, guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			ClassID   uint   `json:"class_id"`
+			StudentNo string `json:"student_no" binding:"required"`
+			Pin       string `json:"pin" binding:"required"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "请输入学号和 PIN"})
+			return
+		}
+
+		keys := []string{studentIPKey(c), fmt.Sprintf("student:%d:%s", input.ClassID, input.StudentNo)}
+		if status := guard.Check(keys...); status.Locked {
+			abortLocked(c, status)
+			return
+		}
+
+		// 学号只在班级内唯一；先校验 PIN 再提示选择班级，避免用学号探测班级
+		query := database.DB.Where("student_no = ? AND status = ?", input.StudentNo, models.StudentActive)
+		if input.ClassID != 0 {
+			query = query.Where("class_id = ?", input.ClassID)
+		}
+		var candidates, matched []models.Student
+		query.Find(&candidates)
+		for _, s := range candidates {
+			if s.CheckPin(input.Pin) {
+				matched = append(matched, s)
+			}
+		}
+		if len(matched) == 0 {
+			status := guard.Fail(keys...)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "学号或 PIN 错误", "lockout": status})
+			return
+		}
+		if len(matched) > 1 {
+			classIDs := make([]uint, 0, len(matched))
+			for _, s := range matched {
+				classIDs = append(classIDs, s.ClassID)
+			}
+			var classes []models.Class
+			database.DB.Where("id IN ?", classIDs).Order("id").Find(&classes)
+			c.JSON(http.StatusBadRequest, gin.H{"error": "学号在多个班级中存在，请选择班级", "classes": classes})
+			return
+		}
+		student := matched[0]
+		guard.Succeed(keys...)
+
+		token, session, err := NewSession(models.SessionKindStudent, student.ID, c.ClientIP(), cfg.SessionTTL)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "登录失败"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":    "登录成功",
+			"token":      token,
+			"expires_at": session.ExpiresAt,
+			"student":    student,
+		})
+	}
+}
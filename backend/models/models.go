@@ -1,20 +1,142 @@
 package models
 
 import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
 	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
-// 学生
-type Student struct {
+// 班级
+type Class struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	Name      string    `json:"name" gorm:"size:100"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// 学期，每个班级同时只有一个未结束的学期
+type Term struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	ClassID   uint       `json:"class_id" gorm:"index"`
+	Name      string     `json:"name" gorm:"size:100"`
+	StartedAt time.Time  `json:"started_at"`
+	ClosedAt  *time.Time `json:"closed_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// 学期结束时的学生最终成绩存档
+type TermStanding struct {
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	TermID    uint   `json:"term_id" gorm:"index"`
+	StudentID uint   `json:"student_id" gorm:"index"`
+	StudentNo string `json:"student_no" gorm:"size:50"`
+	Name      string `json:"name" gorm:"size:100"`
+	Score     int    `json:"score"`
+	Ranking   int    `json:"ranking"`
+	RankName  string `json:"rank_name" gorm:"size:50"`
+	RankColor string `json:"rank_color" gorm:"size:20"`
+	RankIcon  string `json:"rank_icon" gorm:"size:50"`
+}
+
+// 学期结束时的小组最终成绩存档
+type TermGroupStanding struct {
+	ID      uint   `json:"id" gorm:"primaryKey"`
+	TermID  uint   `json:"term_id" gorm:"index"`
+	GroupID uint   `json:"group_id"`
+	Name    string `json:"name" gorm:"size:100"`
+	Score   int    `json:"score"`
+	Ranking int    `json:"ranking"`
+}
+
+// 小组，Score 为独立累计的小组积分
+type Group struct {
 	ID        uint      `json:"id" gorm:"primaryKey"`
-	StudentNo string    `json:"student_no" gorm:"uniqueIndex;size:50"`
+	ClassID   uint      `json:"class_id" gorm:"index"`
 	Name      string    `json:"name" gorm:"size:100"`
 	Score     int       `json:"score" gorm:"default:0"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
 
+// 小组积分记录
+type GroupScoreRecord struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	GroupID     uint      `json:"group_id" gorm:"index"`
+	Value       int       `json:"value"`
+	Reason      string    `json:"reason" gorm:"size:255"`
+	Category    string    `json:"category" gorm:"size:50"`
+	Mode        string    `json:"mode" gorm:"size:20"` // team / members / both
+	Members     int       `json:"members"`             // 同时给多少名组员加减分
+	TermID      uint      `json:"term_id" gorm:"index"`
+	OperationID uint      `json:"operation_id" gorm:"index"`
+	Status      string    `json:"status" gorm:"size:20;default:active;index"`
+	ReversalOf  uint      `json:"reversal_of" gorm:"index"` // 冲正记录：被撤销的原记录 ID
+	ReversalID  uint      `json:"reversal_id"`              // 已撤销的原记录：对应的冲正记录 ID
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// 小组加分方式
+const (
+	GroupScoreTeam    = "team"    // 只计入小组积分
+	GroupScoreMembers = "members" // 只分发给组员
+	GroupScoreBoth    = "both"    // 小组积分和组员同时计入
+)
+
+// 学生
+type Student struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	ClassID   uint       `json:"class_id" gorm:"uniqueIndex:idx_class_student_no"`
+	StudentNo string     `json:"student_no" gorm:"uniqueIndex:idx_class_student_no;size:50"`
+	Name      string     `json:"name" gorm:"size:100"`
+	Score     int        `json:"score" gorm:"default:0"` // 经验值，累计获得的积分，决定段位和排名
+	Coins     int        `json:"coins" gorm:"default:0"` // 积分币，可以消费，不影响段位
+	Debt      int        `json:"debt" gorm:"default:0"`  // 只在积分下限策略为 debt 时产生，低于下限的欠分，之后的加分先还欠分
+	GroupID   uint       `json:"group_id" gorm:"index"`  // 所在小组，0 表示未分组
+	Status    string     `json:"status" gorm:"size:20;default:active;index"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"` // 移入回收站的时间
+	PinHash   string     `json:"-" gorm:"size:100"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// 学生状态
+const (
+	StudentActive      = "active"      // 在读，参与排名
+	StudentTransferred = "transferred" // 已转出
+	StudentGraduated   = "graduated"   // 已毕业
+	StudentDeleted     = "deleted"     // 在回收站中，可恢复
+)
+
+// 可以手动设置的学生状态（deleted 只能通过删除接口进入）
+func ValidStudentStatus(status string) bool {
+	switch status {
+	case StudentActive, StudentTransferred, StudentGraduated:
+		return true
+	}
+	return false
+}
+
+// 设置学生登录 PIN
+func (s *Student) SetPin(pin string) error {
+	hash, err := hashSecret(pin)
+	if err != nil {
+		return err
+	}
+	s.PinHash = hash
+	return nil
+}
+
+// 校验 PIN（未设置 PIN 的学生无法登录）
+func (s *Student) CheckPin(pin string) bool {
+	return checkSecret(s.PinHash, pin)
+}
+
 // 积分记录
+// 记录只追加不删除：撤销时追加一条数值相反的冲正记录，原记录和冲正记录都标记为 reversed
 type ScoreRecord struct {
 	ID          uint      `json:"id" gorm:"primaryKey"`
 	StudentID   uint      `json:"student_id" gorm:"index"`
@@ -22,25 +144,225 @@ type ScoreRecord struct {
 	Value       int       `json:"value"`
 	Reason      string    `json:"reason" gorm:"size:255"`
 	Category    string    `json:"category" gorm:"size:50"`
+	TermID      uint      `json:"term_id" gorm:"index"`
+	OperationID uint      `json:"operation_id" gorm:"index"`
+	TemplateID  uint      `json:"template_id" gorm:"index"` // 按积分模板加分时的模板 ID
+	RuleID      uint      `json:"rule_id" gorm:"index"`     // 由自动积分规则产生时的规则 ID
+	Balance     string    `json:"balance" gorm:"size:10;default:both"`
+	Status      string    `json:"status" gorm:"size:20;default:active;index"`
+	ReversalOf  uint      `json:"reversal_of" gorm:"index"` // 冲正记录：被撤销的原记录 ID
+	ReversalID  uint      `json:"reversal_id"`              // 已撤销的原记录：对应的冲正记录 ID
+	Actor       string    `json:"actor" gorm:"size:100"`    // 记录人，冲正记录为撤销人
 	CreatedAt   time.Time `json:"created_at"`
 }
 
+// 积分记录影响的余额
+const (
+	BalanceBoth  = "both"  // 同时计入经验值和积分币（默认）
+	BalanceXP    = "xp"    // 只计入经验值
+	BalanceCoins = "coins" // 只计入积分币，例如兑换奖励
+)
+
+func ValidBalance(balance string) bool {
+	return balance == BalanceBoth || balance == BalanceXP || balance == BalanceCoins
+}
+
+// 积分记录状态
+const (
+	RecordActive   = "active"
+	RecordReversed = "reversed"
+)
+
+// 积分操作：一次加分、批量加分或小组加分，同一操作产生的记录共享 OperationID，可以整体撤销
+type ScoreOperation struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	ClassID     uint       `json:"class_id" gorm:"index"`
+	Kind        string     `json:"kind" gorm:"size:20"`
+	Value       int        `json:"value"`
+	Reason      string     `json:"reason" gorm:"size:255"`
+	Category    string     `json:"category" gorm:"size:50"`
+	TemplateID  uint       `json:"template_id"`
+	RecordCount int        `json:"record_count"`
+	TeacherID   uint       `json:"teacher_id" gorm:"index"`
+	Actor       string     `json:"actor" gorm:"size:100"`
+	UndoneAt    *time.Time `json:"undone_at"`
+	UndoneBy    string     `json:"undone_by" gorm:"size:100"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// 积分操作类型
+const (
+	OperationSingle = "single"
+	OperationBatch  = "batch"
+	OperationGroup  = "group"
+	OperationRule   = "rule"
+)
+
 // 积分模板
 type ScoreTemplate struct {
-	ID       uint   `json:"id" gorm:"primaryKey"`
-	Name     string `json:"name" gorm:"size:100"`
-	Value    int    `json:"value"`
-	Category string `json:"category" gorm:"size:50"`
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	ClassID    uint   `json:"class_id" gorm:"index"`
+	Name       string `json:"name" gorm:"size:100"`
+	Value      int    `json:"value"`
+	Category   string `json:"category" gorm:"size:50"`
+	ScoreLimit `gorm:"embedded"`
 }
 
-// 段位配置
+// 每个学生的加分上限，0 表示不限；只限制加分，扣分不受限制
+type ScoreLimit struct {
+	DailyTimes   int `json:"daily_times"`   // 每天最多加分次数
+	WeeklyTimes  int `json:"weekly_times"`  // 每周最多加分次数
+	DailyPoints  int `json:"daily_points"`  // 每天最多加多少分
+	WeeklyPoints int `json:"weekly_points"` // 每周最多加多少分
+}
+
+// 分类加分上限（每个班级按分类设置）
+type CategoryLimit struct {
+	ID         uint   `json:"id" gorm:"primaryKey"`
+	ClassID    uint   `json:"class_id" gorm:"uniqueIndex:idx_class_category"`
+	Category   string `json:"category" gorm:"size:50;uniqueIndex:idx_class_category"`
+	ScoreLimit `gorm:"embedded"`
+}
+
+// 奖励商品（每个班级一套），用积分币兑换
+type Reward struct {
+	ID              uint      `json:"id" gorm:"primaryKey"`
+	ClassID         uint      `json:"class_id" gorm:"index"`
+	Name            string    `json:"name" gorm:"size:100"`
+	Description     string    `json:"description" gorm:"size:255"`
+	Cost            int       `json:"cost"`              // 兑换所需积分币
+	Stock           int       `json:"stock"`             // 剩余库存，-1 表示不限
+	PerStudentLimit int       `json:"per_student_limit"` // 每个学生最多兑换次数，0 表示不限
+	Active          bool      `json:"active"`            // 是否上架
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// 奖励兑换记录：兑换时立即扣除积分币，教师兑现后标记为 fulfilled，取消时退回积分币和库存
+type Redemption struct {
+	ID          uint       `json:"id" gorm:"primaryKey"`
+	ClassID     uint       `json:"class_id" gorm:"index"`
+	RewardID    uint       `json:"reward_id" gorm:"index"`
+	StudentID   uint       `json:"student_id" gorm:"index"`
+	Student     Student    `json:"student" gorm:"foreignKey:StudentID"`
+	RewardName  string     `json:"reward_name" gorm:"size:100"` // 兑换时的奖励名称
+	Cost        int        `json:"cost"`
+	Status      string     `json:"status" gorm:"size:20;default:pending;index"`
+	RecordID    uint       `json:"record_id" gorm:"index"` // 扣除积分币的积分记录
+	RequestedBy string     `json:"requested_by" gorm:"size:100"`
+	HandledBy   string     `json:"handled_by" gorm:"size:100"` // 兑现或取消的教师
+	HandledAt   *time.Time `json:"handled_at"`
+	Note        string     `json:"note" gorm:"size:255"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// 兑换状态
+const (
+	RedemptionPending   = "pending"   // 待兑现
+	RedemptionFulfilled = "fulfilled" // 已兑现
+	RedemptionCancelled = "cancelled" // 已取消，积分币已退回
+)
+
+// 兑换奖励产生的积分记录分类
+const RedemptionCategory = "兑换奖励"
+
+// 自动积分规则：每天或每周固定时间给满足条件的在读学生加减分
+// 每周规则统计本周一零点到运行时间的记录，每日规则统计当天的记录
+type ScoreRule struct {
+	ID                uint       `json:"id" gorm:"primaryKey"`
+	ClassID           uint       `json:"class_id" gorm:"index"`
+	Name              string     `json:"name" gorm:"size:100"`
+	Weekday           int        `json:"weekday"`                           // 0-6 表示周日到周六，-1 表示每天
+	RunAt             string     `json:"run_at" gorm:"size:5"`              // 运行时间，例如 17:00
+	Condition         string     `json:"condition" gorm:"size:20"`          // all / no_deductions / min_gain
+	ConditionCategory string     `json:"condition_category" gorm:"size:50"` // 条件只统计该分类，为空表示全部分类
+	Threshold         int        `json:"threshold"`                         // min_gain 时统计周期内至少加了多少分
+	Value             int        `json:"value"`
+	Reason            string     `json:"reason" gorm:"size:255"`
+	Category          string     `json:"category" gorm:"size:50"`
+	Active            bool       `json:"active"`
+	LastRunAt         *time.Time `json:"last_run_at"` // 最近一次按计划运行的时间点
+	CreatedAt         time.Time  `json:"created_at"`
+	UpdatedAt         time.Time  `json:"updated_at"`
+}
+
+// 自动积分规则的条件
+const (
+	RuleAll          = "all"           // 所有在读学生
+	RuleNoDeductions = "no_deductions" // 统计周期内没有扣分
+	RuleMinGain      = "min_gain"      // 统计周期内加分达到 Threshold
+)
+
+// 自动积分规则的运行记录，同一规则的同一时间点只运行一次
+type ScoreRuleRun struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	RuleID       uint      `json:"rule_id" gorm:"uniqueIndex:idx_rule_scheduled_for"`
+	ClassID      uint      `json:"class_id" gorm:"index"`
+	ScheduledFor time.Time `json:"scheduled_for" gorm:"uniqueIndex:idx_rule_scheduled_for"` // 计划运行的时间点，手动运行为触发时间
+	Trigger      string    `json:"trigger" gorm:"size:20"`                                  // schedule / manual
+	OperationID  uint      `json:"operation_id"`                                            // 可以通过积分操作整体撤销
+	StudentCount int       `json:"student_count"`
+	Error        string    `json:"error" gorm:"size:255"`
+	Actor        string    `json:"actor" gorm:"size:100"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// 规则运行方式
+const (
+	RuleTriggerSchedule = "schedule"
+	RuleTriggerManual   = "manual"
+)
+
+// 连续记录：按模板或分类统计学生连续达成的天数或周数，可设置达到阈值时的奖励
+// 模板和分类都为空时统计全部记录
+type Streak struct {
+	ID             uint      `json:"id" gorm:"primaryKey"`
+	ClassID        uint      `json:"class_id" gorm:"index"`
+	Name           string    `json:"name" gorm:"size:100"`
+	Period         string    `json:"period" gorm:"size:10"` // day / week
+	Kind           string    `json:"kind" gorm:"size:10"`   // gain / clean
+	TemplateID     uint      `json:"template_id"`
+	Category       string    `json:"category" gorm:"size:50"`
+	BonusThreshold int       `json:"bonus_threshold"` // 连续达到多少个周期时奖励，0 表示不奖励
+	BonusValue     int       `json:"bonus_value"`
+	BonusRepeat    bool      `json:"bonus_repeat"` // 每达到阈值的整数倍都奖励一次
+	Active         bool      `json:"active"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+// 连续记录的统计周期和类型
+const (
+	StreakDay   = "day"
+	StreakWeek  = "week"
+	StreakGain  = "gain"  // 周期内有加分
+	StreakClean = "clean" // 周期内没有扣分，只统计已结束的周期
+)
+
+// 已发放的连续奖励，同一次连续的同一档只发一次
+type StreakBonus struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	ClassID   uint      `json:"class_id" gorm:"index"`
+	StreakID  uint      `json:"streak_id" gorm:"uniqueIndex:idx_streak_bonus"`
+	StudentID uint      `json:"student_id" gorm:"uniqueIndex:idx_streak_bonus"`
+	RunStart  time.Time `json:"run_start" gorm:"uniqueIndex:idx_streak_bonus"` // 这次连续开始的周期
+	Count     int       `json:"count" gorm:"uniqueIndex:idx_streak_bonus"`     // 达到的连续周期数
+	RecordID  uint      `json:"record_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// 连续奖励产生的积分记录分类，不计入连续记录的统计
+const StreakCategory = "连续奖励"
+
+// 段位配置（每个班级一套）
 type Rank struct {
-	ID       uint   `json:"id" gorm:"primaryKey"`
-	Name     string `json:"name" gorm:"size:50"`
-	MinScore int    `json:"min_score"`
-	Color    string `json:"color" gorm:"size:20"`
-	Icon     string `json:"icon" gorm:"size:50"`
-	SortOrder int   `json:"sort_order"`
+	ID        uint   `json:"id" gorm:"primaryKey"`
+	ClassID   uint   `json:"class_id" gorm:"index"`
+	Name      string `json:"name" gorm:"size:50"`
+	MinScore  int    `json:"min_score"`
+	Color     string `json:"color" gorm:"size:20"`
+	Icon      string `json:"icon" gorm:"size:50"`
+	SortOrder int    `json:"sort_order"`
 }
 
 // 系统配置
@@ -49,3 +371,219 @@ type Setting struct {
 	Key   string `json:"key" gorm:"uniqueIndex;size:50"`
 	Value string `json:"value" gorm:"type:text"`
 }
+
+// 教师角色
+const (
+	RoleOwner    = "owner"    // 管理员：全部权限
+	RoleHomeroom = "homeroom" // 班主任：管理名单、段位、模板，可操作所有分类积分
+	RoleSubject  = "subject"  // 科任老师：只能在自己负责的分类加减分
+	RoleObserver = "observer" // 观察员：只读
+)
+
+// 教师账号
+type Teacher struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Username     string    `json:"username" gorm:"uniqueIndex;size:50"`
+	Name         string    `json:"name" gorm:"size:100"`
+	PasswordHash string    `json:"-" gorm:"size:100"`
+	Role         string    `json:"role" gorm:"size:20;default:owner"`
+	Categories   string    `json:"categories" gorm:"size:255"` // 科任老师负责的积分分类，逗号分隔
+	Classes      []Class   `json:"classes,omitempty" gorm:"many2many:teacher_classes;"`
+	Groups       []Group   `json:"groups,omitempty" gorm:"many2many:teacher_groups;"` // 科任老师负责的小组，为空时不限
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// 设置密码
+func (t *Teacher) SetPassword(password string) error {
+	hash, err := hashSecret(password)
+	if err != nil {
+		return err
+	}
+	t.PasswordHash = hash
+	return nil
+}
+
+// 校验密码
+func (t *Teacher) CheckPassword(password string) bool {
+	return checkSecret(t.PasswordHash, password)
+}
+
+// 负责的积分分类列表
+func (t *Teacher) CategoryList() []string {
+	var list []string
+	for _, c := range strings.Split(t.Categories, ",") {
+		if c = strings.TrimSpace(c); c != "" {
+			list = append(list, c)
+		}
+	}
+	return list
+}
+
+// 角色是否合法
+func ValidRole(role string) bool {
+	switch role {
+	case RoleOwner, RoleHomeroom, RoleSubject, RoleObserver:
+		return true
+	}
+	return false
+}
+
+// 家长账号
+type Parent struct {
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	Username     string    `json:"username" gorm:"uniqueIndex;size:50"`
+	Name         string    `json:"name" gorm:"size:100"`
+	PasswordHash string    `json:"-" gorm:"size:100"`
+	Students     []Student `json:"students,omitempty" gorm:"many2many:parent_students;"`
+	CreatedAt    time.Time `json:"created_at"`
+	UpdatedAt    time.Time `json:"updated_at"`
+}
+
+// 设置密码
+func (p *Parent) SetPassword(password string) error {
+	hash, err := hashSecret(password)
+	if err != nil {
+		return err
+	}
+	p.PasswordHash = hash
+	return nil
+}
+
+// 校验密码
+func (p *Parent) CheckPassword(password string) bool {
+	return checkSecret(p.PasswordHash, password)
+}
+
+// 家长邀请码（老师为某个学生生成，家长注册或绑定时使用一次）
+type ParentInvite struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	Code      string     `json:"code" gorm:"uniqueIndex;size:20"`
+	StudentID uint       `json:"student_id" gorm:"index"`
+	CreatedBy uint       `json:"created_by"`
+	ParentID  *uint      `json:"parent_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// 会话类型
+const (
+	SessionKindTeacher = "teacher"
+	SessionKindStudent = "student"
+	SessionKindParent  = "parent"
+)
+
+// 登录会话（只保存令牌哈希）
+type Session struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;size:64"`
+	Kind      string     `json:"kind" gorm:"size:20;index:idx_session_subject"`
+	SubjectID uint       `json:"subject_id" gorm:"index:idx_session_subject"`
+	ClientIP  string     `json:"client_ip" gorm:"size:64"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	RevokedAt *time.Time `json:"revoked_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// 会话是否有效
+func (s *Session) Active(now time.Time) bool {
+	return s.RevokedAt == nil && now.Before(s.ExpiresAt)
+}
+
+// 审计日志（哈希链防篡改）
+type AuditEntry struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	TeacherID uint      `json:"teacher_id" gorm:"index"`
+	Actor     string    `json:"actor" gorm:"size:50;index"`
+	Method    string    `json:"method" gorm:"size:10"`
+	Route     string    `json:"route" gorm:"size:100;index"`
+	TargetID  string    `json:"target_id" gorm:"size:50;index"`
+	Before    string    `json:"before" gorm:"type:text"`
+	After     string    `json:"after" gorm:"type:text"`
+	Status    int       `json:"status"`
+	ClientIP  string    `json:"client_ip" gorm:"size:64"`
+	PrevHash  string    `json:"prev_hash" gorm:"size:64"`
+	Hash      string    `json:"hash" gorm:"size:64"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// 计算本条日志的哈希（包含上一条的哈希，形成链）
+func (e *AuditEntry) ComputeHash() string {
+	payload := fmt.Sprintf("%s|%d|%s|%s|%s|%s|%s|%s|%d|%s|%d",
+		e.PrevHash, e.TeacherID, e.Actor, e.Method, e.Route, e.TargetID,
+		e.Before, e.After, e.Status, e.ClientIP, e.CreatedAt.UnixMilli())
+	sum := sha256.Sum256([]byte(payload))
+	return hex.EncodeToString(sum[:])
+}
+
+// 危险操作确认令牌（一次性，绑定具体操作和教师）
+type ConfirmToken struct {
+	ID        uint       `json:"id" gorm:"primaryKey"`
+	TokenHash string     `json:"-" gorm:"uniqueIndex;size:64"`
+	Operation string     `json:"operation" gorm:"size:50"`
+	TeacherID uint       `json:"teacher_id" gorm:"index"`
+	ClassID   uint       `json:"class_id"`  // 只能用于签发时的班级
+	TargetID  uint       `json:"target_id"` // 针对单个对象的操作（如彻底删除学生）只能用于该对象
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// 幂等键：保存带 Idempotency-Key 的写请求的响应，重复请求直接返回保存的响应
+type IdempotencyKey struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	Actor       string    `json:"actor" gorm:"size:100;uniqueIndex:idx_idempotency_actor_key"`
+	Key         string    `json:"key" gorm:"size:100;uniqueIndex:idx_idempotency_actor_key"`
+	RequestHash string    `json:"-" gorm:"size:64"` // 方法、路径、班级和请求体的哈希，防止同一个键用于不同请求
+	Status      int       `json:"status"`           // 0 表示请求仍在处理中
+	Response    string    `json:"-" gorm:"type:mediumtext"`
+	ExpiresAt   time.Time `json:"expires_at" gorm:"index"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// bcrypt 哈希密码、PIN 等口令
+func hashSecret(secret string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+// 校验口令，哈希为空时一律失败
+func checkSecret(hash, secret string) bool {
+	if hash == "" {
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(hash), []byte(secret)) == nil
+}
+
+// API 密钥（供脚本和第三方集成使用，只保存哈希）
+type APIKey struct {
+	ID         uint       `json:"id" gorm:"primaryKey"`
+	Name       string     `json:"name" gorm:"size:100"`
+	Prefix     string     `json:"prefix" gorm:"size:20"`
+	KeyHash    string     `json:"-" gorm:"uniqueIndex;size:64"`
+	Scopes     string     `json:"scopes" gorm:"size:255"` // 逗号分隔，例如 "score:write,students:read"
+	CreatedBy  uint       `json:"created_by"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"revoked_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// 密钥是否可用
+func (k *APIKey) Active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// 是否拥有某个权限范围
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range strings.Split(k.Scopes, ",") {
+		if strings.TrimSpace(s) == scope {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,299 @@
+package scheduler
+
+import (
+	"errors"
+	"log"
+	"strconv"
+	"time"
+
+	"score-backend/database"
+	"score-backend/models"
+	"score-backend/scoring"
+	"score-backend/streaks"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 同一时间点已经运行过（多实例部署时由其他实例运行）
+var ErrAlreadyRun = errors.New("该规则在这个时间点已经运行过")
+
+// 启动自动积分规则调度：每分钟检查一次到期的规则，每小时发放一次连续奖励
+// 服务停机期间错过的运行时间点，启动后只补跑最近的一次
+func Start() {
+	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+		for now := range ticker.C {
+			runDue(now)
+			if now.Minute() == 0 {
+				streaks.AwardBonuses(now)
+			}
+		}
+	}()
+}
+
+func runDue(now time.Time) {
+	var rules []models.ScoreRule
+	if err := database.DB.Where("active = ?", true).Find(&rules).Error; err != nil {
+		log.Printf("加载自动积分规则失败: %v", err)
+		return
+	}
+	for _, rule := range rules {
+		slot, ok := LastSlot(rule, now)
+		if !ok || slot.Before(rule.CreatedAt) {
+			continue
+		}
+		if rule.LastRunAt != nil && !slot.After(*rule.LastRunAt) {
+			continue
+		}
+		if _, err := Run(rule, slot, models.RuleTriggerSchedule, Actor(rule)); err != nil && !errors.Is(err, ErrAlreadyRun) {
+			log.Printf("自动积分规则 %d 运行失败: %v", rule.ID, err)
+		}
+	}
+}
+
+// 规则产生的积分记录的操作人
+func Actor(rule models.ScoreRule) string {
+	return "rule:" + strconv.Itoa(int(rule.ID))
+}
+
+// 解析 HH:MM 格式的运行时间
+func ParseRunAt(runAt string) (hour, minute int, ok bool) {
+	t, err := time.Parse("15:04", runAt)
+	if err != nil {
+		return 0, 0, false
+	}
+	return t.Hour(), t.Minute(), true
+}
+
+// 规则在 now 之前（含）最近一次应运行的时间点
+func LastSlot(rule models.ScoreRule, now time.Time) (time.Time, bool) {
+	hour, minute, ok := ParseRunAt(rule.RunAt)
+	if !ok {
+		return time.Time{}, false
+	}
+	slot := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+	if rule.Weekday < 0 {
+		if slot.After(now) {
+			slot = slot.AddDate(0, 0, -1)
+		}
+		return slot, true
+	}
+	slot = slot.AddDate(0, 0, -((int(now.Weekday()) - rule.Weekday + 7) % 7))
+	if slot.After(now) {
+		slot = slot.AddDate(0, 0, -7)
+	}
+	return slot, true
+}
+
+// 规则在 now 之后下一次运行的时间点
+func NextSlot(rule models.ScoreRule, now time.Time) (time.Time, bool) {
+	slot, ok := LastSlot(rule, now)
+	if !ok {
+		return slot, false
+	}
+	if rule.Weekday < 0 {
+		return slot.AddDate(0, 0, 1), true
+	}
+	return slot.AddDate(0, 0, 7), true
+}
+
+// 统计周期的开始：每日规则为当天零点，每周规则为本周一零点
+func PeriodStart(rule models.ScoreRule, at time.Time) time.Time {
+	if rule.Weekday < 0 {
+		return scoring.DayStart(at)
+	}
+	return scoring.WeekStart(at)
+}
+
+// 满足规则条件的学生及其统计周期内的积分情况
+type Candidate struct {
+	StudentID  uint   `json:"student_id"`
+	StudentNo  string `json:"student_no"`
+	Name       string `json:"name"`
+	Gained     int    `json:"gained"`     // 统计周期内的加分
+	Deductions int    `json:"deductions"` // 统计周期内的扣分次数
+}
+
+// 按积分记录评估规则，返回 at 时刻满足条件的在读学生（按 ID 升序）
+// 只统计有效的积分记录（已撤销和只涉及积分币的不算），也不统计该规则自己产生的记录
+// 本统计周期内已经由该规则加过分的学生不再入选，手动运行后按计划运行不会重复发放
+func Evaluate(rule models.ScoreRule, at time.Time) ([]Candidate, error) {
+	var students []models.Student
+	if err := database.DB.Where("class_id = ? AND status = ?", rule.ClassID, models.StudentActive).Order("id ASC").Find(&students).Error; err != nil {
+		return nil, err
+	}
+
+	var stats []struct {
+		StudentID  uint
+		Gained     int
+		Deductions int
+	}
+	query := database.DB.Model(&models.ScoreRecord{}).
+		Select("student_id, COALESCE(SUM(CASE WHEN value > 0 THEN value ELSE 0 END), 0) AS gained, COALESCE(SUM(CASE WHEN value < 0 THEN 1 ELSE 0 END), 0) AS deductions").
+		Where("student_id IN (?)", database.DB.Model(&models.Student{}).Select("id").Where("class_id = ? AND status = ?", rule.ClassID, models.StudentActive)).
+		Where("status = ? AND balance <> ?", models.RecordActive, models.BalanceCoins).
+		Where("rule_id IS NULL OR rule_id <> ?", rule.ID).
+		Where("created_at >= ? AND created_at < ?", PeriodStart(rule, at), at)
+	if rule.ConditionCategory != "" {
+		query = query.Where("category = ?", rule.ConditionCategory)
+	}
+	if err := query.Group("student_id").Scan(&stats).Error; err != nil {
+		return nil, err
+	}
+	byStudent := make(map[uint]int, len(stats))
+	for i, s := range stats {
+		byStudent[s.StudentID] = i
+	}
+	var awarded []uint
+	if err := awardedSince(database.DB, rule, at).Pluck("student_id", &awarded).Error; err != nil {
+		return nil, err
+	}
+	skip := make(map[uint]bool, len(awarded))
+	for _, id := range awarded {
+		skip[id] = true
+	}
+
+	candidates := []Candidate{}
+	for _, student := range students {
+		if skip[student.ID] {
+			continue
+		}
+		candidate := Candidate{StudentID: student.ID, StudentNo: student.StudentNo, Name: student.Name}
+		if i, ok := byStudent[student.ID]; ok {
+			candidate.Gained, candidate.Deductions = stats[i].Gained, stats[i].Deductions
+		}
+		switch rule.Condition {
+		case models.RuleNoDeductions:
+			if candidate.Deductions > 0 {
+				continue
+			}
+		case models.RuleMinGain:
+			if candidate.Gained < rule.Threshold {
+				continue
+			}
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, nil
+}
+
+// 运行规则：给 at 时刻满足条件的学生加减分，整次运行记为一个积分操作，可以整体撤销
+// 按计划运行时同时更新规则的 LastRunAt，失败也不再重试这个时间点
+func Run(rule models.ScoreRule, at time.Time, trigger, actor string) (*models.ScoreRuleRun, error) {
+	run := models.ScoreRuleRun{
+		RuleID:       rule.ID,
+		ClassID:      rule.ClassID,
+		ScheduledFor: at,
+		Trigger:      trigger,
+		Actor:        actor,
+	}
+
+	candidates, err := Evaluate(rule, at)
+	if err == nil {
+		err = database.DB.Transaction(func(tx *gorm.DB) error {
+			// 先写运行记录占住这个时间点，唯一索引保证不会重复运行
+			if err := tx.Create(&run).Error; err != nil {
+				return err
+			}
+			if len(candidates) > 0 {
+				op := models.ScoreOperation{
+					ClassID:  rule.ClassID,
+					Kind:     models.OperationRule,
+					Value:    rule.Value,
+					Reason:   rule.Reason,
+					Category: rule.Category,
+					Actor:    actor,
+				}
+				if err := tx.Create(&op).Error; err != nil {
+					return err
+				}
+				run.OperationID = op.ID
+			}
+
+			for _, candidate := range candidates {
+				// 锁住学生后再确认一次，同时进行的手动运行和按计划运行只有一次生效
+				var student models.Student
+				if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&student, candidate.StudentID).Error; err != nil {
+					continue
+				}
+				var count int64
+				if err := awardedSince(tx, rule, at).Where("student_id = ?", student.ID).Count(&count).Error; err != nil {
+					return err
+				}
+				if count > 0 {
+					continue
+				}
+
+				_, err := scoring.Apply(tx, scoring.Change{
+					StudentID:   candidate.StudentID,
+					Value:       rule.Value,
+					Reason:      rule.Reason,
+					Category:    rule.Category,
+					OperationID: run.OperationID,
+					RuleID:      rule.ID,
+					Actor:       actor,
+				})
+				// 评估后才转出或触及下限的学生直接跳过，这些错误发生在写入之前
+				if errors.Is(err, scoring.ErrStudentNotFound) || errors.Is(err, scoring.ErrStudentInactive) || errors.Is(err, scoring.ErrBelowFloor) {
+					continue
+				}
+				if err != nil {
+					return err
+				}
+				run.StudentCount++
+			}
+
+			if run.OperationID != 0 {
+				if err := tx.Model(&models.ScoreOperation{}).Where("id = ?", run.OperationID).Update("record_count", run.StudentCount).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Model(&run).Updates(map[string]interface{}{"operation_id": run.OperationID, "student_count": run.StudentCount}).Error; err != nil {
+				return err
+			}
+			if trigger == models.RuleTriggerSchedule {
+				return tx.Model(&models.ScoreRule{}).Where("id = ?", rule.ID).Update("last_run_at", at).Error
+			}
+			return nil
+		})
+	}
+	if err == nil {
+		return &run, nil
+	}
+
+	var existing int64
+	database.DB.Model(&models.ScoreRuleRun{}).Where("rule_id = ? AND scheduled_for = ?", rule.ID, at).Count(&existing)
+	if existing > 0 {
+		return nil, ErrAlreadyRun
+	}
+
+	failed := models.ScoreRuleRun{
+		RuleID:       rule.ID,
+		ClassID:      rule.ClassID,
+		ScheduledFor: at,
+		Trigger:      trigger,
+		Actor:        actor,
+		Error:        truncate(err.Error(), 255),
+	}
+	database.DB.Create(&failed)
+	if trigger == models.RuleTriggerSchedule {
+		database.DB.Model(&models.ScoreRule{}).Where("id = ?", rule.ID).Update("last_run_at", at)
+	}
+	return &failed, err
+}
+
+// 本统计周期内该规则产生的有效积分记录
+func awardedSince(db *gorm.DB, rule models.ScoreRule, at time.Time) *gorm.DB {
+	return db.Model(&models.ScoreRecord{}).
+		Where("rule_id = ? AND status = ? AND created_at >= ?", rule.ID, models.RecordActive, PeriodStart(rule, at))
+}
+
+func truncate(s string, n int) string {
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n])
+}
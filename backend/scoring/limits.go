@@ -0,0 +1,100 @@
+package scoring
+
+import (
+	"fmt"
+	"time"
+
+	"score-backend/models"
+
+	"gorm.io/gorm"
+)
+
+// 一项加分上限：TemplateID 不为 0 时统计该模板的加分，否则统计该分类的加分
+type Limit struct {
+	models.ScoreLimit
+	Name       string // 提示中显示的名称，例如 模板「回答问题」
+	TemplateID uint
+	Category   string
+}
+
+// 超出加分上限
+type LimitError struct {
+	Name   string `json:"name"`
+	Period string `json:"period"` // day / week
+	Kind   string `json:"kind"`   // times / points
+	Limit  int    `json:"limit"`
+	Used   int    `json:"used"`
+}
+
+func (e *LimitError) Error() string {
+	period := "今日"
+	if e.Period == "week" {
+		period = "本周"
+	}
+	if e.Kind == "times" {
+		return fmt.Sprintf("%s%s已加分 %d 次，达到上限 %d 次", e.Name, period, e.Used, e.Limit)
+	}
+	return fmt.Sprintf("%s%s已加 %d 分，上限 %d 分", e.Name, period, e.Used, e.Limit)
+}
+
+// 按加分上限检查本次加分，返回实际可加的分值
+// 次数超限时拒绝；分数超限时 partial 为 true 则只加到上限，否则拒绝
+// 需要在已锁住学生行的事务中调用，保证并发加分时统计准确
+func checkLimits(tx *gorm.DB, studentID uint, value int, limits []Limit, partial bool) (int, error) {
+	now := time.Now()
+	periods := []struct {
+		name  string
+		start time.Time
+	}{
+		{"day", DayStart(now)},
+		{"week", WeekStart(now)},
+	}
+
+	for _, limit := range limits {
+		for _, period := range periods {
+			maxTimes, maxPoints := limit.DailyTimes, limit.DailyPoints
+			if period.name == "week" {
+				maxTimes, maxPoints = limit.WeeklyTimes, limit.WeeklyPoints
+			}
+			if maxTimes <= 0 && maxPoints <= 0 {
+				continue
+			}
+
+			query := tx.Model(&models.ScoreRecord{}).
+				Where("student_id = ? AND status = ? AND value > 0 AND created_at >= ?", studentID, models.RecordActive, period.start)
+			if limit.TemplateID != 0 {
+				query = query.Where("template_id = ?", limit.TemplateID)
+			} else {
+				query = query.Where("category = ?", limit.Category)
+			}
+			var times, points int
+			if err := query.Select("COUNT(*), COALESCE(SUM(value), 0)").Row().Scan(&times, &points); err != nil {
+				return 0, err
+			}
+
+			if maxTimes > 0 && times >= maxTimes {
+				return 0, &LimitError{Name: limit.Name, Period: period.name, Kind: "times", Limit: maxTimes, Used: times}
+			}
+			if maxPoints > 0 && points+value > maxPoints {
+				remaining := maxPoints - points
+				if !partial || remaining <= 0 {
+					return 0, &LimitError{Name: limit.Name, Period: period.name, Kind: "points", Limit: maxPoints, Used: points}
+				}
+				value = remaining
+			}
+		}
+	}
+	return value, nil
+}
+
+// 当天零点
+func DayStart(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// 所在周的周一零点
+func WeekStart(t time.Time) time.Time {
+	offset := (int(t.Weekday()) + 6) % 7
+	return DayStart(t).AddDate(0, 0, -offset)
+}
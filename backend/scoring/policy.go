@@ -0,0 +1,44 @@
+package scoring
+
+import (
+	"score-backend/models"
+	"score-backend/settings"
+)
+
+// 按积分上下限策略计算学生加减 value 分后的积分和欠分
+// applied 为实际计入的分值：clamp 和上限截断时可能小于 value，debt 模式下欠分也计入
+// 欠分视为负的积分，之后的加分先还欠分；只有 debt 模式会产生欠分，
+// 其他模式下遗留的欠分（策略从 debt 改过来时）在下次变动时并入积分
+func applyPolicy(policy settings.ScorePolicy, student models.Student, value int) (score, debt, applied int, err error) {
+	balance := student.Score - student.Debt
+	target := balance + value
+
+	if value > 0 && policy.Ceiling != nil && target > *policy.Ceiling {
+		// 上限调低后已经超出的积分不会被扣掉
+		target = *policy.Ceiling
+		if target < balance {
+			target = balance
+		}
+	}
+
+	if policy.Floor != nil && target < *policy.Floor {
+		floor := *policy.Floor
+		switch {
+		case policy.FloorMode == settings.FloorDebt:
+			// 停在下限，不足部分记为欠分
+			return floor, floor - target, target - balance, nil
+		case value >= 0:
+			// 下限调高后仍低于下限的学生，加分照常计入，不产生欠分
+			return target, 0, target - balance, nil
+		case policy.FloorMode == settings.FloorReject:
+			return 0, 0, 0, ErrBelowFloor
+		default:
+			// 已经在下限（或低于下限）时不再扣分，遗留的欠分同样并入积分
+			if balance <= floor {
+				return balance, 0, 0, nil
+			}
+			target = floor
+		}
+	}
+	return target, 0, target - balance, nil
+}
@@ -0,0 +1,75 @@
+package scoring
+
+import (
+	"errors"
+	"testing"
+
+	"score-backend/models"
+	"score-backend/settings"
+)
+
+func intPtr(v int) *int { return &v }
+
+func TestApplyPolicy(t *testing.T) {
+	clamp := settings.ScorePolicy{Floor: intPtr(0), FloorMode: settings.FloorClamp}
+	reject := settings.ScorePolicy{Floor: intPtr(0), FloorMode: settings.FloorReject}
+	debt := settings.ScorePolicy{Floor: intPtr(0), FloorMode: settings.FloorDebt}
+	raised := settings.ScorePolicy{Floor: intPtr(10), FloorMode: settings.FloorClamp}
+	raisedReject := settings.ScorePolicy{Floor: intPtr(10), FloorMode: settings.FloorReject}
+	ceiling := settings.ScorePolicy{Ceiling: intPtr(100), FloorMode: settings.FloorClamp}
+
+	tests := []struct {
+		name                string
+		policy              settings.ScorePolicy
+		score, debt, value  int
+		wantScore, wantDebt int
+		wantApplied         int
+		wantErr             error
+	}{
+		{name: "无限制扣成负数", policy: settings.ScorePolicy{FloorMode: settings.FloorClamp}, score: 0, value: -5, wantScore: -5, wantApplied: -5},
+
+		{name: "clamp 正常加分", policy: clamp, score: 10, value: 5, wantScore: 15, wantApplied: 5},
+		{name: "clamp 扣到下限为止", policy: clamp, score: 3, value: -5, wantScore: 0, wantApplied: -3},
+		{name: "clamp 已在下限不再扣", policy: clamp, score: 0, value: -5, wantScore: 0, wantApplied: 0},
+		{name: "clamp 下限调高后加分照常计入", policy: raised, score: 5, value: 3, wantScore: 8, wantApplied: 3},
+		{name: "clamp 下限调高后加分越过下限", policy: raised, score: 5, value: 8, wantScore: 13, wantApplied: 8},
+		{name: "clamp 下限调高后扣分不变", policy: raised, score: 5, value: -3, wantScore: 5, wantApplied: 0},
+
+		{name: "reject 正常扣分", policy: reject, score: 10, value: -5, wantScore: 5, wantApplied: -5},
+		{name: "reject 扣到正好下限", policy: reject, score: 5, value: -5, wantScore: 0, wantApplied: -5},
+		{name: "reject 低于下限拒绝", policy: reject, score: 3, value: -5, wantErr: ErrBelowFloor},
+		{name: "reject 下限调高后加分不产生欠分", policy: raisedReject, score: 5, value: 3, wantScore: 8, wantApplied: 3},
+
+		{name: "debt 不足部分记为欠分", policy: debt, score: 3, value: -5, wantScore: 0, wantDebt: 2, wantApplied: -5},
+		{name: "debt 欠分继续累加", policy: debt, score: 0, debt: 2, value: -3, wantScore: 0, wantDebt: 5, wantApplied: -3},
+		{name: "debt 加分先还欠分", policy: debt, score: 0, debt: 2, value: 5, wantScore: 3, wantApplied: 5},
+		{name: "debt 加分不够还清欠分", policy: debt, score: 0, debt: 5, value: 3, wantScore: 0, wantDebt: 2, wantApplied: 3},
+
+		{name: "上限截断加分", policy: ceiling, score: 95, value: 10, wantScore: 100, wantApplied: 5},
+		{name: "上限调低后超出部分保留", policy: ceiling, score: 120, value: 5, wantScore: 120, wantApplied: 0},
+		{name: "上限不影响扣分", policy: ceiling, score: 120, value: -5, wantScore: 115, wantApplied: -5},
+
+		{name: "debt 改为 clamp 后扣分不变，欠分并入积分", policy: clamp, score: 0, debt: 4, value: -2, wantScore: -4, wantApplied: 0},
+		{name: "debt 改为 clamp 后 0 分变动也并入欠分", policy: clamp, score: 2, debt: 4, value: 0, wantScore: -2, wantApplied: 0},
+		{name: "debt 改为 clamp 后加分并入积分", policy: clamp, score: 0, debt: 4, value: 3, wantScore: -1, wantApplied: 3},
+		{name: "debt 改为 reject 后加分还清欠分", policy: reject, score: 0, debt: 4, value: 10, wantScore: 6, wantApplied: 10},
+		{name: "debt 改为 reject 后扣分拒绝", policy: reject, score: 0, debt: 4, value: -1, wantErr: ErrBelowFloor},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			student := models.Student{Score: tt.score, Debt: tt.debt}
+			score, debt, applied, err := applyPolicy(tt.policy, student, tt.value)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if score != tt.wantScore || debt != tt.wantDebt || applied != tt.wantApplied {
+				t.Errorf("got score=%d debt=%d applied=%d, want score=%d debt=%d applied=%d",
+					score, debt, applied, tt.wantScore, tt.wantDebt, tt.wantApplied)
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package scoring
+
+import (
+	"errors"
+	"time"
+
+	"score-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrRewardUnavailable = errors.New("奖励不存在或已下架")
+	ErrOutOfStock        = errors.New("奖励库存不足")
+	ErrRedeemLimit       = errors.New("已达到该奖励的兑换次数上限")
+	ErrRedemptionHandled = errors.New("该兑换已处理")
+)
+
+// 在事务 tx 中兑换奖励：扣库存、扣积分币并创建待兑现的兑换记录
+// 加锁顺序：先奖励，再学生；调用方需确认奖励和学生属于同一个班级
+func Redeem(tx *gorm.DB, rewardID, studentID uint, actor string) (*models.Redemption, *Result, error) {
+	var reward models.Reward
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&reward, rewardID).Error; err != nil || !reward.Active {
+		return nil, nil, ErrRewardUnavailable
+	}
+	if reward.Stock == 0 {
+		return nil, nil, ErrOutOfStock
+	}
+	if reward.PerStudentLimit > 0 {
+		var count int64
+		err := tx.Model(&models.Redemption{}).
+			Where("reward_id = ? AND student_id = ? AND status <> ?", reward.ID, studentID, models.RedemptionCancelled).
+			Count(&count).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		if count >= int64(reward.PerStudentLimit) {
+			return nil, nil, ErrRedeemLimit
+		}
+	}
+
+	result, err := Apply(tx, Change{
+		StudentID: studentID,
+		Value:     -reward.Cost,
+		Reason:    "兑换：" + reward.Name,
+		Category:  models.RedemptionCategory,
+		Actor:     actor,
+		Balance:   models.BalanceCoins,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if reward.Stock > 0 {
+		if err := tx.Model(&reward).Update("stock", reward.Stock-1).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+
+	redemption := &models.Redemption{
+		ClassID:     reward.ClassID,
+		RewardID:    reward.ID,
+		StudentID:   studentID,
+		RewardName:  reward.Name,
+		Cost:        reward.Cost,
+		Status:      models.RedemptionPending,
+		RecordID:    result.Record.ID,
+		RequestedBy: actor,
+	}
+	if err := tx.Create(redemption).Error; err != nil {
+		return nil, nil, err
+	}
+	return redemption, result, nil
+}
+
+// 在事务 tx 中取消待兑现的兑换：冲正扣积分币的记录，退回积分币和库存
+func CancelRedemption(tx *gorm.DB, redemption *models.Redemption, note, actor string) (*Result, error) {
+	// 与兑换相同的加锁顺序，奖励已删除时不退库存
+	var reward models.Reward
+	hasReward := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&reward, redemption.RewardID).Error == nil
+
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(redemption, redemption.ID).Error; err != nil {
+		return nil, err
+	}
+	if redemption.Status != models.RedemptionPending {
+		return nil, ErrRedemptionHandled
+	}
+
+	var record models.ScoreRecord
+	if err := tx.First(&record, redemption.RecordID).Error; err != nil {
+		return nil, ErrRecordNotFound
+	}
+	result, err := Revert(tx, &record, "取消兑换："+redemption.RewardName, actor)
+	if err != nil {
+		return nil, err
+	}
+
+	if hasReward && reward.Stock >= 0 {
+		if err := tx.Model(&reward).Update("stock", reward.Stock+1).Error; err != nil {
+			return nil, err
+		}
+	}
+
+	now := time.Now()
+	redemption.Status, redemption.HandledBy, redemption.HandledAt, redemption.Note = models.RedemptionCancelled, actor, &now, note
+	err = tx.Model(redemption).Updates(map[string]interface{}{
+		"status":     redemption.Status,
+		"handled_by": actor,
+		"handled_at": now,
+		"note":       note,
+	}).Error
+	return result, err
+}
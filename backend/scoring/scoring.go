@@ -0,0 +1,276 @@
+package scoring
+
+import (
+	"errors"
+	"time"
+
+	"score-backend/models"
+	"score-backend/settings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrStudentNotFound = errors.New("学生不存在")
+	ErrStudentInactive = errors.New("该学生不是在读状态")
+	ErrRecordNotFound  = errors.New("记录不存在或已撤销")
+	ErrOperationUndone = errors.New("该操作已撤销")
+	ErrBelowFloor      = errors.New("扣分后积分将低于下限")
+	ErrNotEnoughCoins  = errors.New("积分币余额不足")
+)
+
+// 一次积分变动
+type Change struct {
+	StudentID   uint
+	Value       int
+	Reason      string
+	Category    string
+	OperationID uint    // 所属积分操作，用于整体撤销
+	TemplateID  uint    // 使用的积分模板
+	RuleID      uint    // 产生该变动的自动积分规则
+	Actor       string  // 操作者
+	Limits      []Limit // 适用的加分上限，只对加分生效
+	Partial     bool    // 超出分数上限时只加到上限，不整体拒绝
+	Balance     string  // 影响的余额，为空时同时计入经验值和积分币
+}
+
+// 积分变动结果，NewScore（经验值）和 Coins 为提交后的实际余额，Record.Value 为实际加减的分值
+type Result struct {
+	Record   models.ScoreRecord `json:"record"`
+	OldScore int                `json:"old_score"`
+	NewScore int                `json:"new_score"`
+	Coins    int                `json:"coins"`  // 变动后的积分币
+	Debt     int                `json:"debt"`   // 变动后的欠分
+	Capped   bool               `json:"capped"` // 受加分上限或积分上下限限制，只计入了一部分
+}
+
+// 在事务 tx 中给学生加减积分并写入记录
+// 先锁住学生行再更新，并发修改同一学生时按顺序执行，不会丢失更新
+func Apply(tx *gorm.DB, change Change) (*Result, error) {
+	student, err := lockStudent(tx, change.StudentID)
+	if err != nil {
+		return nil, err
+	}
+	if student.Status != models.StudentActive {
+		return nil, ErrStudentInactive
+	}
+
+	value := change.Value
+	if value > 0 && len(change.Limits) > 0 {
+		if value, err = checkLimits(tx, student.ID, value, change.Limits, change.Partial); err != nil {
+			return nil, err
+		}
+	}
+
+	balance := change.Balance
+	if balance == "" {
+		balance = models.BalanceBoth
+	}
+	// 只扣积分币（兑换奖励）时余额必须足够
+	if balance == models.BalanceCoins && value < 0 && student.Coins+value < 0 {
+		return nil, ErrNotEnoughCoins
+	}
+
+	result := &Result{}
+	if value, err = updateBalances(tx, student, value, balance, result); err != nil {
+		return nil, err
+	}
+	result.Capped = value != change.Value
+
+	result.Record = models.ScoreRecord{
+		StudentID:   student.ID,
+		Value:       value,
+		Reason:      change.Reason,
+		Category:    change.Category,
+		TermID:      ActiveTerm(tx, student.ClassID).ID,
+		OperationID: change.OperationID,
+		TemplateID:  change.TemplateID,
+		RuleID:      change.RuleID,
+		Balance:     balance,
+		Status:      models.RecordActive,
+		Actor:       change.Actor,
+	}
+	if err := tx.Create(&result.Record).Error; err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// 在事务 tx 中撤销一条积分记录：追加一条冲正记录并扣回积分，原记录保留
+// 返回的 Result.Record 为冲正记录；记录只能撤销一次，重复撤销返回 ErrRecordNotFound
+func Revert(tx *gorm.DB, record *models.ScoreRecord, reason, actor string) (*Result, error) {
+	student, err := lockStudent(tx, record.StudentID)
+	if err != nil {
+		return nil, err
+	}
+
+	var original models.ScoreRecord
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&original, record.ID).Error; err != nil {
+		return nil, ErrRecordNotFound
+	}
+	if original.Status != models.RecordActive {
+		return nil, ErrRecordNotFound
+	}
+
+	if reason == "" {
+		reason = "撤销：" + original.Reason
+	}
+	// 冲正同样受积分上下限约束，冲正记录记的是实际扣回的分值
+	result := &Result{}
+	value, err := updateBalances(tx, student, -original.Value, original.Balance, result)
+	if err != nil {
+		return nil, err
+	}
+	result.Capped = value != -original.Value
+
+	reversal := models.ScoreRecord{
+		StudentID:  original.StudentID,
+		Value:      value,
+		Reason:     reason,
+		Category:   original.Category,
+		TermID:     original.TermID,
+		TemplateID: original.TemplateID,
+		Balance:    original.Balance,
+		Status:     models.RecordReversed,
+		ReversalOf: original.ID,
+		Actor:      actor,
+	}
+	if err := tx.Create(&reversal).Error; err != nil {
+		return nil, err
+	}
+	err = tx.Model(&original).Updates(map[string]interface{}{"status": models.RecordReversed, "reversal_id": reversal.ID}).Error
+	if err != nil {
+		return nil, err
+	}
+	*record = original
+	result.Record = reversal
+	return result, nil
+}
+
+// 在事务 tx 中整体撤销一次积分操作：冲正小组积分记录和全部仍有效的学生记录
+// 操作只能撤销一次，重复撤销返回 ErrOperationUndone
+func RevertOperation(tx *gorm.DB, op *models.ScoreOperation, reason, actor string) ([]Result, error) {
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(op, op.ID).Error; err != nil {
+		return nil, err
+	}
+	if op.UndoneAt != nil {
+		return nil, ErrOperationUndone
+	}
+	if reason == "" {
+		reason = "撤销：" + op.Reason
+	}
+
+	// 与小组加分相同的加锁顺序：先小组，再按 ID 升序锁学生
+	var groupRecords []models.GroupScoreRecord
+	err := tx.Where("operation_id = ? AND status = ?", op.ID, models.RecordActive).Find(&groupRecords).Error
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range groupRecords {
+		// 小组已删除时没有小组积分可扣回，只冲正记录
+		if record.Mode != models.GroupScoreMembers {
+			if _, err := ApplyGroup(tx, record.GroupID, -record.Value); err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+				return nil, err
+			}
+		}
+		reversal := models.GroupScoreRecord{
+			GroupID:    record.GroupID,
+			Value:      -record.Value,
+			Reason:     reason,
+			Category:   record.Category,
+			Mode:       record.Mode,
+			Members:    record.Members,
+			TermID:     record.TermID,
+			Status:     models.RecordReversed,
+			ReversalOf: record.ID,
+		}
+		if err := tx.Create(&reversal).Error; err != nil {
+			return nil, err
+		}
+		err := tx.Model(&record).Updates(map[string]interface{}{"status": models.RecordReversed, "reversal_id": reversal.ID}).Error
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var records []models.ScoreRecord
+	err = tx.Where("operation_id = ? AND status = ?", op.ID, models.RecordActive).Order("student_id ASC").Find(&records).Error
+	if err != nil {
+		return nil, err
+	}
+	results := make([]Result, 0, len(records))
+	for i := range records {
+		result, err := Revert(tx, &records[i], reason, actor)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, *result)
+	}
+
+	now := time.Now()
+	op.UndoneAt, op.UndoneBy = &now, actor
+	if err := tx.Model(op).Updates(map[string]interface{}{"undone_at": now, "undone_by": actor}).Error; err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// 按余额类型给已锁住的学生加减 value 分，新的余额写入 result，返回实际计入的分值
+// 经验值受积分上下限策略约束；同时计入两种余额时积分币按经验值实际计入的分值变动
+func updateBalances(tx *gorm.DB, student models.Student, value int, balance string, result *Result) (int, error) {
+	result.OldScore, result.NewScore, result.Debt, result.Coins = student.Score, student.Score, student.Debt, student.Coins
+	if balance != models.BalanceCoins {
+		policy, err := settings.LoadScorePolicy(student.ClassID)
+		if err != nil {
+			return 0, err
+		}
+		if result.NewScore, result.Debt, value, err = applyPolicy(policy, student, value); err != nil {
+			return 0, err
+		}
+	}
+	if balance != models.BalanceXP {
+		result.Coins += value
+	}
+	err := tx.Model(&student).Updates(map[string]interface{}{
+		"score": result.NewScore,
+		"debt":  result.Debt,
+		"coins": result.Coins,
+	}).Error
+	return value, err
+}
+
+// 在事务 tx 中原子地修改小组积分，返回修改后的小组积分
+func ApplyGroup(tx *gorm.DB, groupID uint, value int) (int, error) {
+	var group models.Group
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&group, groupID).Error; err != nil {
+		return 0, err
+	}
+	group.Score += value
+	if err := tx.Model(&group).Update("score", group.Score).Error; err != nil {
+		return 0, err
+	}
+	return group.Score, nil
+}
+
+// 班级当前未结束的学期，不存在时自动创建
+func ActiveTerm(db *gorm.DB, classID uint) models.Term {
+	var term models.Term
+	err := db.Where("class_id = ? AND closed_at IS NULL", classID).Order("id DESC").First(&term).Error
+	if err != nil {
+		term = models.Term{ClassID: classID, Name: "第一学期", StartedAt: time.Now()}
+		db.Create(&term)
+	}
+	return term
+}
+
+func lockStudent(tx *gorm.DB, id uint) (models.Student, error) {
+	var student models.Student
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("status <> ?", models.StudentDeleted).
+		First(&student, id).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return student, ErrStudentNotFound
+	}
+	return student, err
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
 )
 
 type Student struct {
@@ -66,12 +67,23 @@ func main() {
 		{StudentNo: "50", Name: "黄传钦"},
 	}
 
+	// 使用只有 students:write 权限的 API 密钥，在管理后台创建
+	apiKey := os.Getenv("SCORE_API_KEY")
+	if apiKey == "" {
+		fmt.Println("请设置环境变量 SCORE_API_KEY")
+		return
+	}
+
 	data := map[string][]Student{"students": students}
 	jsonData, _ := json.Marshal(data)
 
 	req, _ := http.NewRequest("POST", "http://localhost:8080/api/admin/students/batch", bytes.NewBuffer(jsonData))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Admin-Password", "admin123")
+	req.Header.Set("X-API-Key", apiKey)
+	// 导入到指定班级，不设置时使用第一个班级
+	if classID := os.Getenv("SCORE_CLASS_ID"); classID != "" {
+		req.Header.Set("X-Class-ID", classID)
+	}
 
 	client := &http.Client{}
 	resp, err := client.Do(req)
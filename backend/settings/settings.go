@@ -0,0 +1,101 @@
+package settings
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"score-backend/database"
+	"score-backend/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// 配置项（存储在 settings 表中，值为 JSON）
+const (
+	KeyPrivacy     = "privacy_policy" // 按班级保存为 privacy_policy:<班级 ID>
+	KeyScorePolicy = "score_policy"   // 按班级保存为 score_policy:<班级 ID>
+)
+
+// 读取配置到 v，不存在时保持 v 不变
+func Get(key string, v interface{}) error {
+	var setting models.Setting
+	err := database.DB.Where("`key` = ?", key).First(&setting).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal([]byte(setting.Value), v)
+}
+
+// 保存配置
+func Set(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	setting := models.Setting{Key: key, Value: string(data)}
+	return database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "key"}},
+		DoUpdates: clause.AssignmentColumns([]string{"value"}),
+	}).Create(&setting).Error
+}
+
+// 公开数据的隐私策略
+type PrivacyPolicy struct {
+	MaskNames           bool   `json:"mask_names"`            // 姓名只显示第一个字
+	TopN                int    `json:"top_n"`                 // 只公开前 N 名，0 表示不限
+	HideNegative        bool   `json:"hide_negative"`         // 公开接口不显示扣分记录
+	HideReversed        bool   `json:"hide_reversed"`         // 公开接口不显示已撤销的记录及其冲正记录
+	RequireDisplayToken bool   `json:"require_display_token"` // 需要班级展示令牌才能访问公开数据
+	DisplayToken        string `json:"display_token"`
+}
+
+// 班级的隐私策略配置项
+func PrivacyKey(classID uint) string {
+	return fmt.Sprintf("%s:%d", KeyPrivacy, classID)
+}
+
+// 读取班级的隐私策略，没有设置时不限制
+func LoadPrivacy(classID uint) (PrivacyPolicy, error) {
+	var policy PrivacyPolicy
+	err := Get(PrivacyKey(classID), &policy)
+	return policy, err
+}
+
+// 积分上下限策略
+type ScorePolicy struct {
+	Floor     *int   `json:"floor"`      // 最低积分，为空表示不限
+	Ceiling   *int   `json:"ceiling"`    // 最高积分，为空表示不限，超出部分不计
+	FloorMode string `json:"floor_mode"` // 扣分低于下限时：clamp 扣到下限为止，reject 拒绝，debt 停在下限并记为欠分
+}
+
+// 扣分低于下限时的处理方式
+const (
+	FloorClamp  = "clamp"
+	FloorReject = "reject"
+	FloorDebt   = "debt"
+)
+
+// 班级的积分上下限策略配置项
+func ScorePolicyKey(classID uint) string {
+	return fmt.Sprintf("%s:%d", KeyScorePolicy, classID)
+}
+
+// 读取班级的积分上下限策略，没有设置时不限
+func LoadScorePolicy(classID uint) (ScorePolicy, error) {
+	policy := ScorePolicy{FloorMode: FloorClamp}
+	err := Get(ScorePolicyKey(classID), &policy)
+	return policy, err
+}
+
+// 学期重置后的积分：0，设置了更高的下限时为下限
+func (p ScorePolicy) ResetScore() int {
+	if p.Floor != nil && *p.Floor > 0 {
+		return *p.Floor
+	}
+	return 0
+}
@@ -0,0 +1,226 @@
+package streaks
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"strconv"
+	"time"
+
+	"score-backend/database"
+	"score-backend/models"
+	"score-backend/scoring"
+
+	"gorm.io/gorm"
+)
+
+// 学生在某个连续记录上的当前和最长连续周期数
+type Result struct {
+	StreakID uint       `json:"streak_id"`
+	Name     string     `json:"name"`
+	Period   string     `json:"period"`
+	Kind     string     `json:"kind"`
+	Current  int        `json:"current"`
+	Best     int        `json:"best"`
+	RunStart *time.Time `json:"run_start"` // 当前这次连续开始的周期，没有连续时为空
+}
+
+// 周期开始时间
+func periodStart(period string, t time.Time) time.Time {
+	if period == models.StreakWeek {
+		return scoring.WeekStart(t)
+	}
+	return scoring.DayStart(t)
+}
+
+// 后移 n 个周期
+func shift(period string, t time.Time, n int) time.Time {
+	if period == models.StreakWeek {
+		return t.AddDate(0, 0, 7*n)
+	}
+	return t.AddDate(0, 0, n)
+}
+
+// 按积分记录计算学生在连续记录上的连续情况
+// 只统计有效的积分记录（已撤销、只涉及积分币和连续奖励本身的不算），从学生加入的周期开始算
+func Compute(streak models.Streak, students []models.Student, now time.Time) (map[uint]Result, error) {
+	results := make(map[uint]Result, len(students))
+	if len(students) == 0 {
+		return results, nil
+	}
+	ids := make([]uint, len(students))
+	for i, s := range students {
+		ids[i] = s.ID
+	}
+
+	query := database.DB.Model(&models.ScoreRecord{}).
+		Select("student_id, created_at").
+		Where("student_id IN ? AND status = ? AND balance <> ? AND category <> ?", ids, models.RecordActive, models.BalanceCoins, models.StreakCategory)
+	if streak.Kind == models.StreakClean {
+		query = query.Where("value < 0")
+	} else {
+		query = query.Where("value > 0")
+	}
+	if streak.TemplateID != 0 {
+		query = query.Where("template_id = ?", streak.TemplateID)
+	}
+	if streak.Category != "" {
+		query = query.Where("category = ?", streak.Category)
+	}
+	var records []struct {
+		StudentID uint
+		CreatedAt time.Time
+	}
+	if err := query.Scan(&records).Error; err != nil {
+		return nil, err
+	}
+
+	// 每个学生有匹配记录的周期
+	marked := make(map[uint]map[time.Time]bool, len(students))
+	for _, r := range records {
+		if marked[r.StudentID] == nil {
+			marked[r.StudentID] = make(map[time.Time]bool)
+		}
+		marked[r.StudentID][periodStart(streak.Period, r.CreatedAt)] = true
+	}
+
+	current := periodStart(streak.Period, now)
+	for _, student := range students {
+		periods := marked[student.ID]
+		qualifies := func(p time.Time) bool {
+			if streak.Kind == models.StreakClean {
+				return !periods[p]
+			}
+			return periods[p]
+		}
+
+		// 加分类：本周期还没有加分时从上一周期算，不打断连续
+		// 无扣分类：本周期未结束不计入，但本周期已经扣分时连续中断
+		first := periodStart(streak.Period, student.CreatedAt)
+		end := current
+		if streak.Kind == models.StreakClean || !qualifies(current) {
+			end = shift(streak.Period, current, -1)
+		}
+
+		result := Result{StreakID: streak.ID, Name: streak.Name, Period: streak.Period, Kind: streak.Kind}
+		if streak.Kind != models.StreakClean || qualifies(current) {
+			for p := end; !p.Before(first) && qualifies(p); p = shift(streak.Period, p, -1) {
+				result.Current++
+				start := p
+				result.RunStart = &start
+			}
+		}
+		run := 0
+		for p := first; !p.After(end); p = shift(streak.Period, p, 1) {
+			if qualifies(p) {
+				run++
+				if run > result.Best {
+					result.Best = run
+				}
+			} else {
+				run = 0
+			}
+		}
+		results[student.ID] = result
+	}
+	return results, nil
+}
+
+// 班级启用中的连续记录
+func Active(classID uint) []models.Streak {
+	var streaks []models.Streak
+	database.DB.Where("class_id = ? AND active = ?", classID, true).Order("id ASC").Find(&streaks)
+	return streaks
+}
+
+// 学生在班级所有启用中的连续记录上的连续情况
+func ForStudent(student models.Student, now time.Time) []Result {
+	results := []Result{}
+	for _, streak := range Active(student.ClassID) {
+		computed, err := Compute(streak, []models.Student{student}, now)
+		if err != nil {
+			continue
+		}
+		results = append(results, computed[student.ID])
+	}
+	return results
+}
+
+// 给连续周期数达到阈值的在读学生发放奖励
+// 每次连续只在达到阈值时奖励一次，BonusRepeat 时每达到阈值的整数倍再奖励一次
+func AwardBonuses(now time.Time) {
+	var streaks []models.Streak
+	if err := database.DB.Where("active = ? AND bonus_threshold > 0 AND bonus_value <> 0", true).Find(&streaks).Error; err != nil {
+		log.Printf("加载连续记录失败: %v", err)
+		return
+	}
+	for _, streak := range streaks {
+		if err := awardStreak(streak, now); err != nil {
+			log.Printf("连续记录 %d 发放奖励失败: %v", streak.ID, err)
+		}
+	}
+}
+
+func awardStreak(streak models.Streak, now time.Time) error {
+	var students []models.Student
+	if err := database.DB.Where("class_id = ? AND status = ?", streak.ClassID, models.StudentActive).Find(&students).Error; err != nil {
+		return err
+	}
+	results, err := Compute(streak, students, now)
+	if err != nil {
+		return err
+	}
+
+	unit := "天"
+	if streak.Period == models.StreakWeek {
+		unit = "周"
+	}
+	for _, student := range students {
+		result := results[student.ID]
+		if result.Current < streak.BonusThreshold || result.RunStart == nil {
+			continue
+		}
+		// 只发当前达到的最高一档，新建的连续记录不会补发历史上的每一档
+		count := streak.BonusThreshold
+		if streak.BonusRepeat {
+			count = result.Current / streak.BonusThreshold * streak.BonusThreshold
+		}
+
+		var existing int64
+		database.DB.Model(&models.StreakBonus{}).
+			Where("streak_id = ? AND student_id = ? AND run_start = ? AND count = ?", streak.ID, student.ID, *result.RunStart, count).
+			Count(&existing)
+		if existing > 0 {
+			continue
+		}
+
+		err := database.DB.Transaction(func(tx *gorm.DB) error {
+			bonus := models.StreakBonus{
+				ClassID:   streak.ClassID,
+				StreakID:  streak.ID,
+				StudentID: student.ID,
+				RunStart:  *result.RunStart,
+				Count:     count,
+			}
+			// 先写奖励记录占住这一档，唯一索引保证不会重复发放
+			if err := tx.Create(&bonus).Error; err != nil {
+				return err
+			}
+			applied, err := scoring.Apply(tx, scoring.Change{
+				StudentID: student.ID,
+				Value:     streak.BonusValue,
+				Reason:    fmt.Sprintf("%s连续 %d %s", streak.Name, count, unit),
+				Category:  models.StreakCategory,
+				Actor:     "streak:" + strconv.Itoa(int(streak.ID)),
+			})
+			if err != nil {
+				return err
+			}
+			return tx.Model(&bonus).Update("record_id", applied.Record.ID).Error
+		})
+		if err != nil && !errors.Is(err, scoring.ErrStudentInactive) && !errors.Is(err, scoring.ErrBelowFloor) {
+			log.Printf("学生 %d 的连续奖励发放失败: %v", student.ID, err)
+		}
+	}
+	return nil
+}
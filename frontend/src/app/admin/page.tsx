@@ -15,7 +15,9 @@ type Tab = 'students' | 'templates' | 'ranks' | 'records';
 
 export default function AdminPage() {
   const [isLoggedIn, setIsLoggedIn] = useState(false);
+  const [username, setUsername] = useState('');
   const [password, setPassword] = useState('');
+  const [token, setToken] = useState('');
   const [loginError, setLoginError] = useState('');
   const [activeTab, setActiveTab] = useState<Tab>('students');
   const [isInitialized, setIsInitialized] = useState(false);
@@ -31,6 +33,7 @@ export default function AdminPage() {
   const [showResetModal, setShowResetModal] = useState(false);
   const [resetPassword, setResetPassword] = useState('');
   const [resetError, setResetError] = useState('');
+  const [confirmToken, setConfirmToken] = useState('');
   const [resetStep, setResetStep] = useState<'password' | 'confirm1' | 'confirm2'>('password');
   const [studentSearchKeyword, setStudentSearchKeyword] = useState('');
   const [showQuickScoreModal, setShowQuickScoreModal] = useState(false);
@@ -54,15 +57,15 @@ export default function AdminPage() {
 
   // 从 localStorage 恢复登录状态
   useEffect(() => {
-    const savedPassword = localStorage.getItem('admin_password');
-    if (savedPassword) {
-      // 验证保存的密码是否有效
-      adminApi.login(savedPassword).then(() => {
-        setPassword(savedPassword);
+    const savedToken = localStorage.getItem('admin_token');
+    if (savedToken) {
+      // 验证保存的令牌是否有效
+      adminApi.me(savedToken).then(() => {
+        setToken(savedToken);
         setIsLoggedIn(true);
         loadAllData();
       }).catch(() => {
-        localStorage.removeItem('admin_password');
+        localStorage.removeItem('admin_token');
       }).finally(() => {
         setIsInitialized(true);
       });
@@ -74,8 +77,10 @@ export default function AdminPage() {
   const handleLogin = async (e: React.FormEvent) => {
     e.preventDefault();
     try {
-      await adminApi.login(password);
-      localStorage.setItem('admin_password', password);
+      const res = await adminApi.login(username, password);
+      localStorage.setItem('admin_token', res.token);
+      setToken(res.token);
+      setPassword('');
       setIsLoggedIn(true);
       setLoginError('');
       loadAllData();
@@ -85,9 +90,10 @@ export default function AdminPage() {
   };
 
   const handleLogout = () => {
-    localStorage.removeItem('admin_password');
+    adminApi.logout(token).catch(() => {});
+    localStorage.removeItem('admin_token');
     setIsLoggedIn(false);
-    setPassword('');
+    setToken('');
   };
 
   const loadAllData = async () => {
@@ -114,9 +120,9 @@ export default function AdminPage() {
     e.preventDefault();
     try {
       if (editingStudent) {
-        await adminApi.updateStudent(password, editingStudent.id, studentForm);
+        await adminApi.updateStudent(token, editingStudent.id, studentForm);
       } else {
-        await adminApi.createStudent(password, studentForm);
+        await adminApi.createStudent(token, studentForm);
       }
       setShowStudentForm(false);
       setEditingStudent(null);
@@ -130,7 +136,7 @@ export default function AdminPage() {
   const handleDeleteStudent = async (id: number) => {
     if (!confirm('确定要删除该学生吗？')) return;
     try {
-      await adminApi.deleteStudent(password, id);
+      await adminApi.deleteStudent(token, id);
       loadAllData();
     } catch (error) {
       alert(error instanceof Error ? error.message : '删除失败');
@@ -140,7 +146,7 @@ export default function AdminPage() {
   const handleUndoRecord = async (id: number) => {
     if (!confirm('确定要撤销该记录吗？')) return;
     try {
-      await adminApi.undoScoreRecord(password, id);
+      await adminApi.undoScoreRecord(token, id);
       loadAllData();
     } catch (error) {
       alert(error instanceof Error ? error.message : '撤销失败');
@@ -151,9 +157,9 @@ export default function AdminPage() {
     e.preventDefault();
     try {
       if (editingTemplate) {
-        await adminApi.updateTemplate(password, editingTemplate.id, templateForm);
+        await adminApi.updateTemplate(token, editingTemplate.id, templateForm);
       } else {
-        await adminApi.createTemplate(password, templateForm);
+        await adminApi.createTemplate(token, templateForm);
       }
       setShowTemplateForm(false);
       setEditingTemplate(null);
@@ -167,7 +173,7 @@ export default function AdminPage() {
   const handleDeleteTemplate = async (id: number) => {
     if (!confirm('确定要删除该模板吗？')) return;
     try {
-      await adminApi.deleteTemplate(password, id);
+      await adminApi.deleteTemplate(token, id);
       loadAllData();
     } catch (error) {
       alert(error instanceof Error ? error.message : '删除失败');
@@ -176,7 +182,7 @@ export default function AdminPage() {
 
   const handleUpdateRankScore = async (id: number, newScore: number) => {
     try {
-      await adminApi.updateRank(password, id, { min_score: newScore });
+      await adminApi.updateRank(token, id, { min_score: newScore });
       setEditingRankId(null);
       loadAllData();
     } catch (error) {
@@ -188,6 +194,7 @@ export default function AdminPage() {
     setShowResetModal(true);
     setResetPassword('');
     setResetError('');
+    setConfirmToken('');
     setResetStep('password');
   };
 
@@ -195,6 +202,7 @@ export default function AdminPage() {
     setShowResetModal(false);
     setResetPassword('');
     setResetError('');
+    setConfirmToken('');
     setResetStep('password');
   };
 
@@ -204,7 +212,8 @@ export default function AdminPage() {
       return;
     }
     try {
-      await adminApi.verifyResetPassword(resetPassword);
+      const res = await adminApi.verifyResetPassword(token, resetPassword, 'reset');
+      setConfirmToken(res.confirm_token);
       setResetError('');
       setResetStep('confirm1');
     } catch (error) {
@@ -217,7 +226,7 @@ export default function AdminPage() {
       setResetStep('confirm2');
     } else if (resetStep === 'confirm2') {
       try {
-        await adminApi.resetAllScores(password);
+        await adminApi.resetAllScores(token, confirmToken);
         closeResetModal();
         loadAllData();
         alert('重置成功');
@@ -246,7 +255,7 @@ export default function AdminPage() {
   const handleQuickScoreSubmit = async () => {
     if (!quickScoreStudentId || quickScoreValue === 0) return;
     try {
-      await adminApi.modifyScore(password, {
+      await adminApi.modifyScore(token, {
         student_id: quickScoreStudentId,
         value: quickScoreValue,
         reason: quickScoreReason || (quickScoreValue > 0 ? '加分' : '减分'),
@@ -332,12 +341,22 @@ export default function AdminPage() {
               </svg>
             </div>
             <h1 className="text-2xl font-bold text-slate-800">管理后台</h1>
-            <p className="text-slate-500 mt-2">请输入管理员密码登录</p>
+            <p className="text-slate-500 mt-2">请输入账号和密码登录</p>
           </div>
 
           <form onSubmit={handleLogin}>
+            <div className="mb-4">
+              <label className="block text-slate-600 text-sm font-medium mb-2">用户名</label>
+              <input
+                type="text"
+                value={username}
+                onChange={(e) => setUsername(e.target.value)}
+                className="w-full px-4 py-3 bg-white border border-slate-200 rounded-xl focus:ring-2 focus:ring-blue-400 focus:border-transparent outline-none transition-all"
+                placeholder="请输入用户名"
+              />
+            </div>
             <div className="mb-6">
-              <label className="block text-slate-600 text-sm font-medium mb-2">管理员密码</label>
+              <label className="block text-slate-600 text-sm font-medium mb-2">密码</label>
               <input
                 type="password"
                 value={password}
@@ -1076,12 +1095,18 @@ export default function AdminPage() {
                           <span className={'text-lg sm:text-xl font-bold ' + (record.value >= 0 ? 'text-emerald-600' : 'text-red-600')}>
                             {record.value >= 0 ? '+' : ''}{record.value}
                           </span>
-                          <button
-                            onClick={() => handleUndoRecord(record.id)}
-                            className="px-2 sm:px-3 py-1 sm:py-1.5 text-slate-500 hover:text-red-600 hover:bg-red-50 rounded-lg text-xs sm:text-sm transition-colors"
-                          >
-                            撤销
-                          </button>
+                          {record.status === 'reversed' ? (
+                            <span className="px-2 sm:px-3 py-1 sm:py-1.5 text-slate-400 text-xs sm:text-sm">
+                              {record.reversal_of ? '冲正' : '已撤销'}
+                            </span>
+                          ) : (
+                            <button
+                              onClick={() => handleUndoRecord(record.id)}
+                              className="px-2 sm:px-3 py-1 sm:py-1.5 text-slate-500 hover:text-red-600 hover:bg-red-50 rounded-lg text-xs sm:text-sm transition-colors"
+                            >
+                              撤销
+                            </button>
+                          )}
                         </div>
                       </div>
                     ))
@@ -1347,11 +1372,11 @@ export default function AdminPage() {
                     </li>
                     <li className="flex items-center gap-2">
                       <span className="w-1.5 h-1.5 bg-red-500 rounded-full"></span>
-                      所有积分记录将被删除
+                      当前学期的成绩和排名将存档，积分记录保留
                     </li>
                     <li className="flex items-center gap-2">
                       <span className="w-1.5 h-1.5 bg-red-500 rounded-full"></span>
-                      此操作不可恢复
+                      新学期从零开始，无法回到当前学期
                     </li>
                   </ul>
                 </div>
@@ -1388,7 +1413,7 @@ export default function AdminPage() {
                     ⚠️ 这是最后一步 ⚠️
                   </p>
                   <p className="text-red-700 text-center mt-2">
-                    点击确认后，所有数据将被立即删除且无法恢复！
+                    点击确认后，当前学期将立即结束并开启新学期！
                   </p>
                 </div>
 
@@ -1,5 +1,23 @@
 const API_BASE = process.env.NEXT_PUBLIC_API_URL || 'http://localhost:8080/api';
 
+// 公开数据需要的班级展示令牌（可通过页面地址 ?display_token= 传入）和已登录教师的令牌
+function publicHeaders(): Record<string, string> {
+  if (typeof window === 'undefined') return {};
+  const fromUrl = new URLSearchParams(window.location.search).get('display_token');
+  if (fromUrl) localStorage.setItem('display_token', fromUrl);
+  const classFromUrl = new URLSearchParams(window.location.search).get('class_id');
+  if (classFromUrl) localStorage.setItem('class_id', classFromUrl);
+
+  const headers: Record<string, string> = {};
+  const displayToken = localStorage.getItem('display_token');
+  if (displayToken) headers['X-Display-Token'] = displayToken;
+  const classId = localStorage.getItem('class_id');
+  if (classId) headers['X-Class-ID'] = classId;
+  const adminToken = localStorage.getItem('admin_token');
+  if (adminToken) headers['Authorization'] = `Bearer ${adminToken}`;
+  return headers;
+}
+
 // 通用请求函数
 async function request<T>(
   endpoint: string,
@@ -10,6 +28,7 @@ async function request<T>(
     ...options,
     headers: {
       'Content-Type': 'application/json',
+      ...publicHeaders(),
       ...options.headers,
     },
   });
@@ -25,14 +44,14 @@ async function request<T>(
 // 带管理员认证的请求
 function adminRequest<T>(
   endpoint: string,
-  password: string,
+  token: string,
   options: RequestInit = {}
 ): Promise<T> {
   return request<T>(endpoint, {
     ...options,
     headers: {
       ...options.headers,
-      'X-Admin-Password': password,
+      Authorization: `Bearer ${token}`,
     },
   });
 }
@@ -44,6 +63,8 @@ export interface Student {
   student_no: string;
   name: string;
   score: number;
+  coins?: number;
+  debt?: number;
   created_at: string;
   updated_at: string;
 }
@@ -64,6 +85,11 @@ export interface ScoreRecord {
   value: number;
   reason: string;
   category: string;
+  template_id?: number;
+  rule_id?: number;
+  balance?: 'both' | 'xp' | 'coins';
+  status?: 'active' | 'reversed';
+  reversal_of?: number;
   created_at: string;
 }
 
@@ -72,6 +98,20 @@ export interface ScoreTemplate {
   name: string;
   value: number;
   category: string;
+  daily_times?: number;
+  weekly_times?: number;
+  daily_points?: number;
+  weekly_points?: number;
+}
+
+export interface Teacher {
+  id: number;
+  username: string;
+  name: string;
+  role: 'owner' | 'homeroom' | 'subject' | 'observer';
+  categories: string;
+  created_at: string;
+  updated_at: string;
 }
 
 export interface Rank {
@@ -145,110 +185,125 @@ export const publicApi = {
 // ============ 管理员API ============
 
 export const adminApi = {
-  // 登录验证
-  login: (password: string) =>
-    request<{ message: string }>('/admin/login', {
+  // 登录，返回会话令牌
+  login: (username: string, password: string) =>
+    request<{ message: string; token: string; expires_at: string; teacher: Teacher }>('/admin/login', {
       method: 'POST',
-      body: JSON.stringify({ password }),
+      body: JSON.stringify({ username, password }),
     }),
 
-  // 验证重置密码
-  verifyResetPassword: (password: string) =>
-    request<{ message: string }>('/admin/verify-reset', {
+  logout: (token: string) =>
+    adminRequest<{ message: string }>('/admin/logout', token, {
       method: 'POST',
-      body: JSON.stringify({ password }),
+    }),
+
+  // 当前登录的教师（用于校验保存的令牌）
+  me: (token: string) =>
+    adminRequest<{ data: Teacher; permissions: string[] }>('/admin/me', token),
+
+  // 验证重置密码，返回绑定到该操作的一次性确认令牌
+  verifyResetPassword: (
+    token: string,
+    password: string,
+    operation: 'reset' | 'students:batch-delete' | 'students:purge',
+    targetId?: number
+  ) =>
+    adminRequest<{ message: string; confirm_token: string; expires_at: string }>('/admin/verify-reset', token, {
+      method: 'POST',
+      body: JSON.stringify({ password, operation, target_id: targetId }),
     }),
 
   // 学生管理
-  createStudent: (password: string, data: { student_no: string; name: string }) =>
-    adminRequest<{ data: Student }>('/admin/students', password, {
+  createStudent: (token: string, data: { student_no: string; name: string }) =>
+    adminRequest<{ data: Student }>('/admin/students', token, {
       method: 'POST',
       body: JSON.stringify(data),
     }),
 
-  updateStudent: (password: string, id: number, data: { student_no: string; name: string }) =>
-    adminRequest<{ data: Student }>(`/admin/students/${id}`, password, {
+  updateStudent: (token: string, id: number, data: { student_no: string; name: string }) =>
+    adminRequest<{ data: Student }>(`/admin/students/${id}`, token, {
       method: 'PUT',
       body: JSON.stringify(data),
     }),
 
-  deleteStudent: (password: string, id: number) =>
-    adminRequest<{ message: string }>(`/admin/students/${id}`, password, {
+  deleteStudent: (token: string, id: number) =>
+    adminRequest<{ message: string }>(`/admin/students/${id}`, token, {
       method: 'DELETE',
     }),
 
-  batchCreateStudents: (password: string, students: { student_no: string; name: string }[]) =>
-    adminRequest<{ data: Student[] }>('/admin/students/batch', password, {
+  batchCreateStudents: (token: string, students: { student_no: string; name: string }[]) =>
+    adminRequest<{ data: Student[] }>('/admin/students/batch', token, {
       method: 'POST',
       body: JSON.stringify({ students }),
     }),
 
   // 积分操作
   modifyScore: (
-    password: string,
-    data: { student_id: number; value: number; reason: string; category: string }
+    token: string,
+    data: { student_id: number; template_id?: number; value?: number; reason?: string; category?: string }
   ) =>
-    adminRequest<{ data: ScoreRecord; new_score: number }>('/admin/score', password, {
+    adminRequest<{ data: ScoreRecord; new_score: number }>('/admin/score', token, {
       method: 'POST',
       body: JSON.stringify(data),
     }),
 
   batchModifyScore: (
-    password: string,
-    data: { student_ids: number[]; value: number; reason: string; category: string }
+    token: string,
+    data: { student_ids: number[]; template_id?: number; value?: number; reason?: string; category?: string }
   ) =>
-    adminRequest<{ message: string }>('/admin/score/batch', password, {
+    adminRequest<{ message: string }>('/admin/score/batch', token, {
       method: 'POST',
       body: JSON.stringify(data),
     }),
 
-  undoScoreRecord: (password: string, id: number) =>
-    adminRequest<{ message: string }>(`/admin/score/${id}`, password, {
+  undoScoreRecord: (token: string, id: number) =>
+    adminRequest<{ message: string }>(`/admin/score/${id}`, token, {
       method: 'DELETE',
     }),
 
   // 积分模板
-  createTemplate: (password: string, data: { name: string; value: number; category: string }) =>
-    adminRequest<{ data: ScoreTemplate }>('/admin/templates', password, {
+  createTemplate: (token: string, data: { name: string; value: number; category: string }) =>
+    adminRequest<{ data: ScoreTemplate }>('/admin/templates', token, {
       method: 'POST',
       body: JSON.stringify(data),
     }),
 
-  updateTemplate: (password: string, id: number, data: { name: string; value: number; category: string }) =>
-    adminRequest<{ data: ScoreTemplate }>(`/admin/templates/${id}`, password, {
+  updateTemplate: (token: string, id: number, data: { name: string; value: number; category: string }) =>
+    adminRequest<{ data: ScoreTemplate }>(`/admin/templates/${id}`, token, {
       method: 'PUT',
       body: JSON.stringify(data),
     }),
 
-  deleteTemplate: (password: string, id: number) =>
-    adminRequest<{ message: string }>(`/admin/templates/${id}`, password, {
+  deleteTemplate: (token: string, id: number) =>
+    adminRequest<{ message: string }>(`/admin/templates/${id}`, token, {
       method: 'DELETE',
     }),
 
   // 段位配置
-  createRank: (password: string, data: { name: string; min_score: number; color: string; icon: string }) =>
-    adminRequest<{ data: Rank }>('/admin/ranks', password, {
+  createRank: (token: string, data: { name: string; min_score: number; color: string; icon: string }) =>
+    adminRequest<{ data: Rank }>('/admin/ranks', token, {
       method: 'POST',
       body: JSON.stringify(data),
     }),
 
-  updateRank: (password: string, id: number, data: Partial<{ name: string; min_score: number; color: string; icon: string }>) =>
-    adminRequest<{ data: Rank }>(`/admin/ranks/${id}`, password, {
+  updateRank: (token: string, id: number, data: Partial<{ name: string; min_score: number; color: string; icon: string }>) =>
+    adminRequest<{ data: Rank }>(`/admin/ranks/${id}`, token, {
       method: 'PUT',
       body: JSON.stringify(data),
     }),
 
-  deleteRank: (password: string, id: number) =>
-    adminRequest<{ message: string }>(`/admin/ranks/${id}`, password, {
+  deleteRank: (token: string, id: number) =>
+    adminRequest<{ message: string }>(`/admin/ranks/${id}`, token, {
       method: 'DELETE',
     }),
 
   // 系统管理
-  resetAllScores: (password: string) =>
-    adminRequest<{ message: string }>('/admin/reset', password, {
+  resetAllScores: (token: string, confirmToken: string) =>
+    adminRequest<{ message: string }>('/admin/reset', token, {
       method: 'POST',
+      headers: { 'X-Confirm-Token': confirmToken },
     }),
 
-  getStatistics: (password: string) =>
-    adminRequest<{ data: Statistics }>('/admin/statistics', password),
+  getStatistics: (token: string) =>
+    adminRequest<{ data: Statistics }>('/admin/statistics', token),
 };